@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	prowapiv1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
+)
+
+// annotationSchemaVersion is the version of the annotations written by encodeJobAnnotations.
+// Version 1 is the format used before the version was recorded: the parameters are a comma
+// separated list and the request type, workflow and config type are not recorded at all.
+const annotationSchemaVersion = 2
+
+// The annotations the bot records a job in on its prow job.
+const (
+	annotationVersion         = "ci-chat-bot.openshift.io/version"
+	annotationOriginalMessage = "ci-chat-bot.openshift.io/originalMessage"
+	annotationMode            = "ci-chat-bot.openshift.io/mode"
+	annotationRequestType     = "ci-chat-bot.openshift.io/requestType"
+	annotationJobParams       = "ci-chat-bot.openshift.io/jobParams"
+	annotationUser            = "ci-chat-bot.openshift.io/user"
+	annotationChannel         = "ci-chat-bot.openshift.io/channel"
+	annotationThread          = "ci-chat-bot.openshift.io/thread"
+	annotationClusterName     = "ci-chat-bot.openshift.io/clusterName"
+	annotationNamespace       = "ci-chat-bot.openshift.io/ns"
+	annotationPlatform        = "ci-chat-bot.openshift.io/platform"
+	annotationJobInputs       = "ci-chat-bot.openshift.io/jobInputs"
+	annotationBuildCluster    = "ci-chat-bot.openshift.io/buildCluster"
+	annotationWorkflowName    = "ci-chat-bot.openshift.io/workflowName"
+	annotationLegacyConfig    = "ci-chat-bot.openshift.io/legacyConfig"
+	annotationTargetType      = "ci-chat-bot.openshift.io/targetType"
+	annotationPriority        = "ci-chat-bot.openshift.io/priority"
+	annotationReservation     = "ci-chat-bot.openshift.io/reservation"
+	annotationLifetime        = "ci-chat-bot.openshift.io/lifetime"
+	annotationApprovedBy      = "ci-chat-bot.openshift.io/approvedBy"
+	// annotationExpires is the number of seconds after the creation of the prow job the cluster expires
+	annotationExpires       = "ci-chat-bot.openshift.io/expires"
+	annotationExpiryWarning = "ci-chat-bot.openshift.io/expiryWarning"
+	// annotationCheckIn is "kept" once the owner confirmed they use the cluster, or the time the
+	// owner was asked in seconds since the epoch
+	annotationCheckIn    = "ci-chat-bot.openshift.io/checkIn"
+	annotationStopReason = "ci-chat-bot.openshift.io/stopReason"
+	// annotationProgressMessage is the channel/ID of the message the progress of a launch is shown in
+	annotationProgressMessage = "ci-chat-bot.openshift.io/progressMessage"
+	// annotationPhase is the last phase of the job the bot recorded, it trails the phase the bot
+	// tracks and is missing on jobs created before phases were recorded
+	annotationPhase = "ci-chat-bot.openshift.io/phase"
+
+	annotationArchitecture = "release.openshift.io/architecture"
+	// annotationLegacyBuildCluster was read for the build cluster by version 1, which never wrote it
+	annotationLegacyBuildCluster = "release.openshift.io/buildCluster"
+
+	// labelLaunch marks the prow jobs created by the bot
+	labelLaunch = "ci-chat-bot.openshift.io/launch"
+)
+
+// encodeJobAnnotations records a job in the annotations of its prow job. The name, state and URL of
+// the job are kept by the prow job itself, and the time it was requested is its creation time.
+// Credentials, failures and the progress of a launch are not recorded, they are found again by
+// waiting for the job. Only the message the progress is shown in is recorded.
+func encodeJobAnnotations(job *Job, namespace string) (map[string]string, error) {
+	inputs, err := json.Marshal(job.Inputs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode job inputs: %v", err)
+	}
+	params := job.JobParams
+	if params == nil {
+		params = make(map[string]string)
+	}
+	paramData, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode job parameters: %v", err)
+	}
+	annotations := map[string]string{
+		annotationVersion:         strconv.Itoa(annotationSchemaVersion),
+		annotationOriginalMessage: job.OriginalMessage,
+		annotationMode:            job.Mode,
+		annotationRequestType:     string(requestTypeForMode(job.Mode)),
+		annotationJobParams:       string(paramData),
+		annotationUser:            job.RequestedBy,
+		annotationChannel:         job.RequestedChannel,
+		annotationThread:          job.RequestedThread,
+		annotationClusterName:     job.ClusterName,
+		annotationNamespace:       namespace,
+		annotationPlatform:        job.Platform,
+		annotationJobInputs:       string(inputs),
+		annotationBuildCluster:    job.BuildCluster,
+		annotationArchitecture:    job.Architecture,
+	}
+	set := func(key, value string) {
+		if len(value) > 0 {
+			annotations[key] = value
+		}
+	}
+	seconds := func(d time.Duration) string {
+		if d <= 0 {
+			return ""
+		}
+		return strconv.Itoa(int(d.Seconds()))
+	}
+	set(annotationWorkflowName, job.WorkflowName)
+	if job.LegacyConfig {
+		annotations[annotationLegacyConfig] = "true"
+	}
+	set(annotationTargetType, job.TargetType)
+	if job.Priority >= PriorityHigh {
+		annotations[annotationPriority] = "high"
+	}
+	set(annotationReservation, job.Reservation)
+	set(annotationLifetime, seconds(job.Lifetime))
+	set(annotationApprovedBy, job.ApprovedBy)
+	if !job.ExpiresAt.IsZero() {
+		set(annotationExpires, seconds(job.ExpiresAt.Sub(job.RequestedAt)))
+	}
+	set(annotationExpiryWarning, seconds(job.ExpiryWarning))
+	switch {
+	case job.Kept:
+		annotations[annotationCheckIn] = "kept"
+	case !job.CheckInSentAt.IsZero():
+		annotations[annotationCheckIn] = strconv.FormatInt(job.CheckInSentAt.Unix(), 10)
+	}
+	set(annotationStopReason, job.StopReason)
+	set(annotationProgressMessage, job.ProgressMessage)
+	set(annotationPhase, string(job.Phase))
+	return annotations, nil
+}
+
+// decodeJobAnnotations restores a job from its prow job, migrating annotations written in older
+// versions. Jobs without inputs were not created by the bot and are rejected.
+func decodeJobAnnotations(pj *prowapiv1.ProwJob) (*Job, error) {
+	annotations := pj.Annotations
+	version := 1
+	if value := annotations[annotationVersion]; len(value) > 0 {
+		var err error
+		if version, err = strconv.Atoi(value); err != nil || version < 1 {
+			return nil, fmt.Errorf("unrecognized annotation version %q", value)
+		}
+		if version > annotationSchemaVersion {
+			return nil, fmt.Errorf("annotations are version %d, this bot only understands up to version %d", version, annotationSchemaVersion)
+		}
+	}
+
+	var inputs []JobInput
+	if value := annotations[annotationJobInputs]; len(value) > 0 {
+		if err := json.Unmarshal([]byte(value), &inputs); err != nil {
+			return nil, fmt.Errorf("could not deserialize job inputs: %v", err)
+		}
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("the job has no inputs")
+	}
+
+	j := &Job{
+		Name:             pj.Name,
+		State:            pj.Status.State,
+		URL:              pj.Status.URL,
+		OriginalMessage:  annotations[annotationOriginalMessage],
+		Mode:             annotations[annotationMode],
+		JobName:          pj.Spec.Job,
+		Platform:         annotations[annotationPlatform],
+		Inputs:           inputs,
+		RequestedBy:      annotations[annotationUser],
+		RequestedChannel: annotations[annotationChannel],
+		RequestedThread:  annotations[annotationThread],
+		ClusterName:      annotations[annotationClusterName],
+		Priority:         priorityFromAnnotation(annotations[annotationPriority]),
+		Reservation:      annotations[annotationReservation],
+		ApprovedBy:       annotations[annotationApprovedBy],
+		RequestedAt:      pj.CreationTimestamp.Time,
+		Architecture:     annotations[annotationArchitecture],
+		BuildCluster:     annotations[annotationBuildCluster],
+		WorkflowName:     annotations[annotationWorkflowName],
+		LegacyConfig:     annotations[annotationLegacyConfig] == "true",
+		TargetType:       annotations[annotationTargetType],
+		StopReason:       annotations[annotationStopReason],
+		ProgressMessage:  annotations[annotationProgressMessage],
+	}
+	if len(j.Architecture) == 0 {
+		j.Architecture = "amd64"
+	}
+	if len(j.BuildCluster) == 0 {
+		j.BuildCluster = annotations[annotationLegacyBuildCluster]
+	}
+	if len(j.BuildCluster) == 0 {
+		j.BuildCluster = pj.Spec.Cluster
+	}
+	// the target type was introduced after the bot started launching clusters
+	if _, ok := annotations[annotationTargetType]; !ok {
+		j.TargetType = "template"
+	}
+
+	var err error
+	if version == 1 {
+		j.JobParams, err = paramsFromAnnotation(annotations[annotationJobParams])
+	} else {
+		j.JobParams = make(map[string]string)
+		if value := annotations[annotationJobParams]; len(value) > 0 {
+			err = json.Unmarshal([]byte(value), &j.JobParams)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not deserialize job parameters: %v", err)
+	}
+
+	seconds := func(key string) time.Duration {
+		if value, err := strconv.Atoi(annotations[key]); err == nil && value > 0 {
+			return time.Duration(value) * time.Second
+		}
+		return 0
+	}
+	j.Lifetime = seconds(annotationLifetime)
+	j.ExpiryWarning = seconds(annotationExpiryWarning)
+	if expires := seconds(annotationExpires); expires > 0 {
+		j.ExpiresAt = pj.CreationTimestamp.Add(expires)
+	}
+	switch checkIn := annotations[annotationCheckIn]; {
+	case checkIn == "kept":
+		j.Kept = true
+	case len(checkIn) > 0:
+		if value, err := strconv.ParseInt(checkIn, 10, 64); err == nil {
+			j.CheckInSentAt = time.Unix(value, 0)
+		}
+	}
+	// the recorded phase may be behind the prow job, and jobs without one get it from the prow job
+	if phase := JobPhase(annotations[annotationPhase]); phase.known() {
+		j.Phase = phase
+	}
+	j.observePhase(j.State)
+	return j, nil
+}
+
+// requestTypeForMode returns the type of request that creates jobs of a mode.
+func requestTypeForMode(mode string) JobType {
+	if mode == JobTypeLaunch {
+		return JobTypeInstall
+	}
+	return JobType(mode)
+}
+
+// requestFromJob restores the request a job was created for. The inputs are the resolved
+// versions and pull requests, so launching the request again creates the same cluster.
+func requestFromJob(job *Job, annotations map[string]string) *JobRequest {
+	var inputs [][]string
+	for _, input := range job.Inputs {
+		var current []string
+		switch {
+		case len(input.Version) > 0:
+			current = append(current, input.Version)
+		case len(input.Image) > 0:
+			current = append(current, input.Image)
+		}
+		for _, ref := range input.Refs {
+			for _, pull := range ref.Pulls {
+				current = append(current, fmt.Sprintf("%s/%s#%d", ref.Org, ref.Repo, pull.Number))
+			}
+		}
+		if len(current) > 0 {
+			inputs = append(inputs, current)
+		}
+	}
+	requestType := JobType(annotations[annotationRequestType])
+	if len(requestType) == 0 {
+		requestType = requestTypeForMode(job.Mode)
+	}
+	return &JobRequest{
+		OriginalMessage: job.OriginalMessage,
+		User:            job.RequestedBy,
+		Inputs:          inputs,
+		Type:            requestType,
+		Platform:        job.Platform,
+		WorkflowName:    job.WorkflowName,
+		Channel:         job.RequestedChannel,
+		Thread:          job.RequestedThread,
+		RequestedAt:     job.RequestedAt,
+		Name:            job.Name,
+		ClusterName:     job.ClusterName,
+		Priority:        job.Priority,
+		Reservation:     job.Reservation,
+		Lifetime:        job.Lifetime,
+		ApprovedBy:      job.ApprovedBy,
+		JobName:         job.JobName,
+		JobParams:       job.JobParams,
+		Architecture:    job.Architecture,
+	}
+}
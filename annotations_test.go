@@ -0,0 +1,299 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	prowapiv1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
+)
+
+// prowJobFor creates the prow job the bot would create for a job.
+func prowJobFor(t *testing.T, job *Job) *prowapiv1.ProwJob {
+	annotations, err := encodeJobAnnotations(job, "ci-ln-abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &prowapiv1.ProwJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              job.Name,
+			CreationTimestamp: metav1.NewTime(job.RequestedAt),
+			Annotations:       annotations,
+		},
+		Spec:   prowapiv1.ProwJobSpec{Job: job.JobName, Cluster: "build01"},
+		Status: prowapiv1.ProwJobStatus{State: job.State, URL: job.URL},
+	}
+}
+
+func TestJobAnnotationsRoundTrip(t *testing.T) {
+	requestedAt := time.Unix(1700000000, 0)
+	inputs := []JobInput{{Version: "4.10.3", Refs: []prowapiv1.Refs{{Org: "openshift", Repo: "origin", Pulls: []prowapiv1.Pull{{Number: 123}}}}}}
+	base := func(mode string) *Job {
+		return &Job{
+			Name:             "chat-bot-2023-11-14-221320.0000",
+			OriginalMessage:  "launch 4.10,openshift/origin#123 aws,fips name=demo lifetime=24h",
+			State:            prowapiv1.PendingState,
+			Phase:            JobPhaseInstalling,
+			JobName:          "release-openshift-origin-installer-launch-aws",
+			URL:              "https://prow.ci.openshift.org/view/gs/bucket/logs/job/1",
+			Platform:         "aws",
+			JobParams:        map[string]string{"fips": "", "KEY": "a,b=c"},
+			TargetType:       "steps",
+			Mode:             mode,
+			Inputs:           inputs,
+			RequestedBy:      "U012AB3CD",
+			RequestedChannel: "C012AB3CD",
+			RequestedThread:  "1700000000.000100",
+			ClusterName:      "demo",
+			Priority:         PriorityHigh,
+			Reservation:      "r4",
+			RequestedAt:      requestedAt,
+			ExpiresAt:        requestedAt.Add(24*time.Hour + 45*time.Minute),
+			Lifetime:         24 * time.Hour,
+			ApprovedBy:       "U045EF6GH",
+			ExpiryWarning:    30 * time.Minute,
+			CheckInSentAt:    requestedAt.Add(90 * time.Minute),
+			StopReason:       "shut down because it was idle",
+			ProgressMessage:  "C012AB3CD/1700000001.000200",
+			Architecture:     "arm64",
+			BuildCluster:     "build02",
+		}
+	}
+	testCases := []struct {
+		name        string
+		job         func() *Job
+		requestType JobType
+	}{
+		{
+			name:        "launch",
+			job:         func() *Job { return base(JobTypeLaunch) },
+			requestType: JobTypeInstall,
+		},
+		{
+			name: "launch with a legacy config that was kept",
+			job: func() *Job {
+				job := base(JobTypeLaunch)
+				job.LegacyConfig = true
+				job.TargetType = "template"
+				job.Kept = true
+				job.CheckInSentAt = time.Time{}
+				return job
+			},
+			requestType: JobTypeInstall,
+		},
+		{
+			name: "workflow launch",
+			job: func() *Job {
+				job := base(JobTypeWorkflowLaunch)
+				job.WorkflowName = "openshift-e2e-gcp"
+				job.JobParams = map[string]string{"KEY": "VALUE", "OTHER": "x=y"}
+				return job
+			},
+			requestType: JobTypeWorkflowLaunch,
+		},
+		{
+			name: "test",
+			job: func() *Job {
+				job := base(JobTypeTest)
+				job.Phase = JobPhaseTesting
+				job.JobParams = map[string]string{"test": "e2e-serial"}
+				job.Priority = PriorityNormal
+				return job
+			},
+			requestType: JobTypeTest,
+		},
+		{
+			name: "upgrade",
+			job: func() *Job {
+				job := base(JobTypeUpgrade)
+				job.Phase = JobPhaseTesting
+				job.Inputs = []JobInput{{Version: "4.9.12"}, {Image: "registry.ci.openshift.org/ocp/release:4.10.3"}}
+				job.JobParams = map[string]string{"test": "e2e-upgrade"}
+				return job
+			},
+			requestType: JobTypeUpgrade,
+		},
+		{
+			name: "build",
+			job: func() *Job {
+				job := base(JobTypeBuild)
+				job.Phase = JobPhaseCreating
+				job.URL = ""
+				job.ClusterName = ""
+				job.Lifetime = 0
+				job.ApprovedBy = ""
+				job.ExpiryWarning = 0
+				job.CheckInSentAt = time.Time{}
+				job.StopReason = ""
+				return job
+			},
+			requestType: JobTypeBuild,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			job := tc.job()
+			pj := prowJobFor(t, job)
+			decoded, err := decodeJobAnnotations(pj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(job, decoded) {
+				t.Errorf("job changed in the round trip:\nexpected %#v\ngot      %#v", job, decoded)
+			}
+
+			req := requestFromJob(decoded, pj.Annotations)
+			if req.Type != tc.requestType {
+				t.Errorf("expected request type %q, got %q", tc.requestType, req.Type)
+			}
+			if req.WorkflowName != job.WorkflowName || req.Lifetime != job.Lifetime || req.Thread != job.RequestedThread || req.Priority != job.Priority {
+				t.Errorf("request does not match the job: %#v", req)
+			}
+			if !reflect.DeepEqual(req.JobParams, job.JobParams) {
+				t.Errorf("expected parameters %v, got %v", job.JobParams, req.JobParams)
+			}
+		})
+	}
+}
+
+func TestDecodeJobAnnotationsMigratesVersion1(t *testing.T) {
+	created := time.Unix(1600000000, 0)
+	pj := &prowapiv1.ProwJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "chat-bot-2020-09-13-122640.0000",
+			CreationTimestamp: metav1.NewTime(created),
+			Annotations: map[string]string{
+				"ci-chat-bot.openshift.io/originalMessage": "launch 4.6 gcp,ovn",
+				"ci-chat-bot.openshift.io/mode":            "launch",
+				"ci-chat-bot.openshift.io/jobParams":       "ovn,test=e2e",
+				"ci-chat-bot.openshift.io/user":            "U012AB3CD",
+				"ci-chat-bot.openshift.io/channel":         "D012AB3CD",
+				"ci-chat-bot.openshift.io/platform":        "gcp",
+				"ci-chat-bot.openshift.io/jobInputs":       `[{"Version":"4.6.1"}]`,
+				"ci-chat-bot.openshift.io/expires":         "10800",
+				"ci-chat-bot.openshift.io/checkIn":         "kept",
+			},
+		},
+		Spec: prowapiv1.ProwJobSpec{Job: "release-openshift-origin-installer-launch-gcp", Cluster: "build01"},
+	}
+	job, err := decodeJobAnnotations(pj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Job{
+		Name:             pj.Name,
+		OriginalMessage:  "launch 4.6 gcp,ovn",
+		JobName:          "release-openshift-origin-installer-launch-gcp",
+		Platform:         "gcp",
+		JobParams:        map[string]string{"ovn": "", "test": "e2e"},
+		TargetType:       "template",
+		Mode:             JobTypeLaunch,
+		Phase:            JobPhaseCreating,
+		Inputs:           []JobInput{{Version: "4.6.1"}},
+		RequestedBy:      "U012AB3CD",
+		RequestedChannel: "D012AB3CD",
+		RequestedAt:      created,
+		ExpiresAt:        created.Add(3 * time.Hour),
+		Kept:             true,
+		Architecture:     "amd64",
+		BuildCluster:     "build01",
+	}
+	if !reflect.DeepEqual(expected, job) {
+		t.Errorf("unexpected job:\nexpected %#v\ngot      %#v", expected, job)
+	}
+	if req := requestFromJob(job, pj.Annotations); req.Type != JobTypeInstall || !reflect.DeepEqual(req.Inputs, [][]string{{"4.6.1"}}) {
+		t.Errorf("unexpected request: %#v", req)
+	}
+}
+
+func TestDecodeJobAnnotationsPhase(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mode     string
+		recorded JobPhase
+		state    prowapiv1.ProwJobState
+		url      string
+		expected JobPhase
+	}{
+		{name: "recorded phase of a running cluster", mode: JobTypeLaunch, recorded: JobPhaseReady, state: prowapiv1.PendingState, expected: JobPhaseReady},
+		{name: "cluster without a recorded phase", mode: JobTypeLaunch, state: prowapiv1.PendingState, url: "https://prow/1", expected: JobPhaseCreating},
+		{name: "test without a recorded phase", mode: JobTypeTest, state: prowapiv1.PendingState, url: "https://prow/1", expected: JobPhaseTesting},
+		{name: "test that has no URL yet", mode: JobTypeTest, state: prowapiv1.TriggeredState, expected: JobPhaseCreating},
+		{name: "cluster that ran until its lifetime was over", mode: JobTypeLaunch, recorded: JobPhaseReady, state: prowapiv1.SuccessState, expected: JobPhaseExpired},
+		{name: "cluster that was shut down", mode: JobTypeLaunch, recorded: JobPhaseTearingDown, state: prowapiv1.AbortedState, expected: JobPhaseSucceeded},
+		{name: "cluster that failed while being shut down", mode: JobTypeLaunch, recorded: JobPhaseTearingDown, state: prowapiv1.FailureState, expected: JobPhaseSucceeded},
+		{name: "cluster that failed to install", mode: JobTypeLaunch, recorded: JobPhaseInstalling, state: prowapiv1.FailureState, expected: JobPhaseFailed},
+		{name: "test that passed", mode: JobTypeTest, recorded: JobPhaseTesting, state: prowapiv1.SuccessState, expected: JobPhaseSucceeded},
+		{name: "test that was aborted", mode: JobTypeTest, state: prowapiv1.AbortedState, expected: JobPhaseFailed},
+		{name: "failure is not undone by the prow job", mode: JobTypeLaunch, recorded: JobPhaseFailed, state: prowapiv1.SuccessState, expected: JobPhaseFailed},
+		{name: "unknown recorded phase", mode: JobTypeLaunch, recorded: "Sleeping", state: prowapiv1.PendingState, expected: JobPhaseCreating},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pj := prowJobFor(t, &Job{Name: "chat-bot-2023-11-14-221320.0000", Mode: tc.mode, Inputs: []JobInput{{Version: "4.10.3"}}, State: tc.state, URL: tc.url})
+			if len(tc.recorded) > 0 {
+				pj.Annotations[annotationPhase] = string(tc.recorded)
+			}
+			job, err := decodeJobAnnotations(pj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if job.Phase != tc.expected {
+				t.Errorf("expected phase %s, got %s", tc.expected, job.Phase)
+			}
+		})
+	}
+}
+
+func TestJobPhaseTransitions(t *testing.T) {
+	job := &Job{Name: "chat-bot-2023-11-14-221320.0000"}
+	for _, phase := range []JobPhase{JobPhaseCreating, JobPhaseScheduled, JobPhaseInstalling, JobPhaseReady, JobPhaseTearingDown, JobPhaseSucceeded} {
+		if err := job.setPhase(phase); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, phase := range []JobPhase{JobPhaseReady, JobPhaseFailed, JobPhaseCreating} {
+		if err := job.setPhase(phase); err == nil {
+			t.Errorf("a job that succeeded moved to %s", phase)
+		}
+	}
+	failed := &Job{Name: "chat-bot-2023-11-14-221320.0000", Phase: JobPhaseFailed}
+	if err := failed.setPhase(JobPhaseCreating); err != nil {
+		t.Errorf("a failed launch could not be refreshed: %v", err)
+	}
+}
+
+func TestDecodeJobAnnotationsRejects(t *testing.T) {
+	testCases := []struct {
+		name        string
+		annotations map[string]string
+	}{
+		{
+			name:        "jobs not created by the bot",
+			annotations: map[string]string{"prow.k8s.io/job": "periodic-ci-openshift-release-master-nightly-4.10-e2e-aws"},
+		},
+		{
+			name: "a newer version",
+			annotations: map[string]string{
+				annotationVersion:   "3",
+				annotationJobInputs: `[{"Version":"4.10.3"}]`,
+			},
+		},
+		{
+			name: "unreadable parameters",
+			annotations: map[string]string{
+				annotationVersion:   "2",
+				annotationJobInputs: `[{"Version":"4.10.3"}]`,
+				annotationJobParams: "fips,ovn",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := decodeJobAnnotations(&prowapiv1.ProwJob{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,1032 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/pkg/version"
+	"k8s.io/klog"
+)
+
+// Bot answers the commands users send it through a chat frontend and notifies them about their
+// clusters and jobs.
+type Bot struct {
+	frontend       ChatFrontend
+	workflowConfig *WorkflowConfig
+	priorityConfig *PriorityConfig
+	// credentials hands out one-time links to cluster credentials, they are uploaded to Slack if unset
+	credentials *credentialStore
+	// extendEnabled offers the extend command and buttons to owners of running clusters
+	extendEnabled bool
+
+	// commands are matched against messages in order
+	commands []*botCommand
+
+	progressLock sync.Mutex
+	// progress holds the progress messages of launches by job name
+	progress map[string]*progressMessage
+}
+
+func NewBot(frontend ChatFrontend, workflowConfig *WorkflowConfig, priorityConfig *PriorityConfig, credentials *credentialStore, extendEnabled bool) *Bot {
+	return &Bot{
+		frontend:       frontend,
+		workflowConfig: workflowConfig,
+		priorityConfig: priorityConfig,
+		credentials:    credentials,
+		extendEnabled:  extendEnabled,
+		progress:       make(map[string]*progressMessage),
+	}
+}
+
+// Start registers the commands of the bot and the notifiers of the manager, and handles commands
+// until the connection of the frontend is lost.
+func (b *Bot) Start(manager JobManager) error {
+	b.registerCommands(manager)
+
+	manager.SetNotifier(b.jobResponder())
+	manager.SetMessageNotifier(b.messageResponder())
+	manager.SetProgressNotifier(b.progressResponder())
+
+	return b.frontend.Listen(b, manager)
+}
+
+// HandleCommand runs the first command that matches a request, like slacker does.
+func (b *Bot) HandleCommand(request *ChatRequest, response ChatResponse) {
+	for _, command := range b.commands {
+		params, ok := command.Match(request.Text)
+		if !ok {
+			continue
+		}
+		request.params = params
+		command.Definition().Handler(request, response)
+		return
+	}
+	response.Reply(unrecognizedCommand(request.Text, b.commands))
+}
+
+// registerCommands defines the commands of the bot. The handlers only reply through the response
+// they are given, so they can be served by any frontend.
+func (b *Bot) registerCommands(manager JobManager) {
+	b.commands = []*botCommand{newBotCommand("help", b.helpDefinition())}
+	command := func(usage string, definition *CommandDefinition) {
+		b.commands = append(b.commands, newBotCommand(usage, definition))
+	}
+
+	command("launch <image_or_version_or_pr> <options>", &CommandDefinition{
+		Description: fmt.Sprintf(
+			"Launch an OpenShift cluster using a known image, version, or PR. You may omit both arguments. Use `nightly` for the latest OCP build, `ci` for the the latest CI build, provide a version directly from any listed on https://amd64.ocp.releases.ci.openshift.org, a stream name (4.1.0-0.ci, 4.1.0-0.nightly, etc), a major/minor `X.Y` to load the \"next stable\" version, from nightly, for that version (`4.1`), `<org>/<repo>#<pr>` to launch from a PR, or an image for the first argument. Options is a comma-delimited list of variations including platform (%s) and variant (%s). Add `name=NAME` to run up to %d clusters side by side, and `lifetime=24h` to request a long-lived cluster, which must be approved.",
+			strings.Join(codeSlice(supportedPlatforms), ", "),
+			strings.Join(codeSlice(supportedParameters), ", "),
+			maxClustersPerUser,
+		),
+		Example: "launch openshift/origin#49563 gcp name=pr",
+		Handler: func(request *ChatRequest, response ChatResponse) {
+			user := request.User
+			channel := request.Channel
+
+			imageOrVersion, options, settings, err := parseLaunchArguments(request.Param("image_or_version_or_pr"), request.Param("options"))
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			options = withDefaultPlatform(options, manager.SettingsForUser(user).Platform)
+			req, err := newLaunchRequest(imageOrVersion, options, settings)
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			req.OriginalMessage = stripLinks(request.Text)
+			req.User = user
+			req.Channel = channel
+			req.Thread = request.Thread
+			req.Priority = b.priorityForUser(user)
+
+			msg, err := manager.LaunchJobForUser(req)
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			response.Reply(msg)
+		},
+	})
+
+	command("lookup <image_or_version_or_pr>", &CommandDefinition{
+		Description: "Get info about a version.",
+		Handler: func(request *ChatRequest, response ChatResponse) {
+			from, err := parseImageInput(request.Param("image_or_version_or_pr"))
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			msg, err := manager.LookupInputs(from)
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			response.Reply(msg)
+		},
+	})
+	command("list", &CommandDefinition{
+		Description: "See who is hogging all the clusters.",
+		Handler: func(request *ChatRequest, response ChatResponse) {
+			response.Reply(manager.ListJobs(request.User))
+		},
+	})
+	command("refresh <name>", &CommandDefinition{
+		Description: "If the cluster is currently marked as failed, retry fetching its credentials in case of an error. Pass the cluster name if you have more than one.",
+		Handler: func(request *ChatRequest, response ChatResponse) {
+			user := request.User
+			msg, err := manager.SyncJobForUser(user, request.Param("name"))
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			response.Reply(msg)
+		},
+	})
+	command("done <name>", &CommandDefinition{
+		Description: "Terminate the running cluster, or leave the waitlist if your cluster has not started yet. Pass the cluster name if you have more than one.",
+		Handler: func(request *ChatRequest, response ChatResponse) {
+			user := request.User
+			msg, err := manager.TerminateJobForUser(user, request.Param("name"))
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			response.Reply(msg)
+		},
+	})
+
+	if b.extendEnabled {
+		command("extend <duration> <name>", &CommandDefinition{
+			Description: "Keep your running cluster up for longer, e.g. `extend 2h`. Pass the cluster name if you have more than one.",
+			Example:     "extend 90m",
+			Handler: func(request *ChatRequest, response ChatResponse) {
+				user := request.User
+				duration, err := time.ParseDuration(request.Param("duration"))
+				if err != nil {
+					response.Reply("you must specify how long to extend your cluster by, e.g. `extend 2h`")
+					return
+				}
+				msg, err := manager.ExtendJobForUser(user, request.Param("name"), duration)
+				if err != nil {
+					response.Reply(err.Error())
+					return
+				}
+				response.Reply(msg)
+			},
+		})
+	}
+
+	command("keep <name>", &CommandDefinition{
+		Description: "Tell me you are still using your cluster when I ask. Pass the cluster name if you have more than one.",
+		Handler: func(request *ChatRequest, response ChatResponse) {
+			user := request.User
+			msg, err := manager.KeepJobForUser(user, request.Param("name"))
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			response.Reply(msg)
+		},
+	})
+
+	command("quota", &CommandDefinition{
+		Description: "See how many cluster-hours you have used recently.",
+		Handler: func(request *ChatRequest, response ChatResponse) {
+			response.Reply(manager.QuotaForUser(request.User))
+		},
+	})
+
+	command("history", &CommandDefinition{
+		Description: "See your most recent jobs that have completed.",
+		Handler: func(request *ChatRequest, response ChatResponse) {
+			response.Reply(manager.HistoryForUser(request.User))
+		},
+	})
+
+	command("settings <settings>", &CommandDefinition{
+		Description: "See or change your defaults. Use `platform=aws` to launch on aws unless a launch names a platform, or `platform=` to go back to gcp.",
+		Example:     "settings platform=aws",
+		Handler: func(request *ChatRequest, response ChatResponse) {
+			settings := manager.SettingsForUser(request.User)
+			if value := request.Param("settings"); len(value) > 0 {
+				var err error
+				if settings, err = parseSettings(settings, value); err != nil {
+					response.Reply(err.Error())
+					return
+				}
+				manager.UpdateSettingsForUser(request.User, settings)
+			}
+			platform := settings.Platform
+			if len(platform) == 0 {
+				platform = "gcp"
+			}
+			response.Reply(fmt.Sprintf("your clusters launch on `%s` unless you name a platform", platform))
+		},
+	})
+
+	command("reserve <count> <platform> <start> <duration>", &CommandDefinition{
+		Description: "Book clusters ahead of time for a demo or bug scrub. The start time is in UTC, the clusters are launched for you when the reservation starts and run until it ends.",
+		Example:     "reserve 2 aws 2026-11-03T14:00 3h",
+		Handler: func(request *ChatRequest, response ChatResponse) {
+			user := request.User
+			channel := request.Channel
+			count, err := strconv.Atoi(request.Param("count"))
+			if err != nil {
+				response.Reply("you must specify how many clusters to reserve, e.g. `reserve 2 aws 2026-11-03T14:00 3h`")
+				return
+			}
+			start, err := parseReservationStart(request.Param("start"))
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			duration, err := time.ParseDuration(request.Param("duration"))
+			if err != nil {
+				response.Reply("you must specify how long the reservation lasts, e.g. `3h`")
+				return
+			}
+			msg, err := manager.ReserveForUser(&Reservation{
+				User:     user,
+				Channel:  channel,
+				Count:    count,
+				Platform: request.Param("platform"),
+				Start:    start,
+				Duration: duration,
+			})
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			response.Reply(msg)
+		},
+	})
+
+	command("reservations", &CommandDefinition{
+		Description: "See the upcoming and active cluster reservations.",
+		Handler: func(request *ChatRequest, response ChatResponse) {
+			response.Reply(manager.ListReservations())
+		},
+	})
+
+	command("unreserve <id>", &CommandDefinition{
+		Description: "Cancel one of your reservations.",
+		Example:     "unreserve r1",
+		Handler: func(request *ChatRequest, response ChatResponse) {
+			msg, err := manager.CancelReservationForUser(request.User, request.Param("id"))
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			response.Reply(msg)
+		},
+	})
+
+	command("approve <id>", &CommandDefinition{
+		Description: "Approve a request for a long-lived cluster. Only accepted in the approval channel.",
+		Handler: func(request *ChatRequest, response ChatResponse) {
+			msg, err := manager.ResolveApproval(request.SourceChannel(), request.User, request.Param("id"), true, "")
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			response.Reply(msg)
+		},
+	})
+
+	command("deny <id> <reason>", &CommandDefinition{
+		Description: "Deny a request for a long-lived cluster. Only accepted in the approval channel.",
+		Handler: func(request *ChatRequest, response ChatResponse) {
+			msg, err := manager.ResolveApproval(request.SourceChannel(), request.User, request.Param("id"), false, request.Param("reason"))
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			response.Reply(msg)
+		},
+	})
+
+	command("auth <name>", &CommandDefinition{
+		Description: "Send the credentials for the cluster you most recently requested. Pass the cluster name if you have more than one.",
+		Handler: func(request *ChatRequest, response ChatResponse) {
+			user := request.User
+			channel := request.Channel
+			job, err := manager.GetLaunchJob(user, request.Param("name"))
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			job.RequestedChannel = channel
+			job.RequestedThread = request.Thread
+			b.notifyJob(response, job)
+		},
+	})
+
+	command("test upgrade <from> <to> <options>", &CommandDefinition{
+		Description: fmt.Sprintf("Run the upgrade tests between two release images. The arguments may be a pull spec of a release image or tags from https://amd64.ocp.releases.ci.openshift.org. You may change the upgrade test by passing `test=NAME` in options with one of %s", strings.Join(codeSlice(supportedUpgradeTests), ", ")),
+		Handler: func(request *ChatRequest, response ChatResponse) {
+			user := request.User
+			channel := request.Channel
+
+			from, err := parseImageInput(request.Param("from"))
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			if len(from) == 0 {
+				response.Reply("you must specify an image to upgrade from and to")
+				return
+			}
+			to, err := parseImageInput(request.Param("to"))
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			// default to to from
+			if len(to) == 0 {
+				to = from
+			}
+
+			platform, architecture, params, err := parseOptions(request.Param("options"))
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+
+			if v := params["test"]; len(v) == 0 {
+				params["test"] = "e2e-upgrade"
+			}
+			if !strings.Contains(params["test"], "-upgrade") {
+				response.Reply("Only upgrade type tests may be run from this command")
+				return
+			}
+
+			msg, err := manager.LaunchJobForUser(&JobRequest{
+				OriginalMessage: stripLinks(request.Text),
+				User:            user,
+				Inputs:          [][]string{from, to},
+				Type:            JobTypeUpgrade,
+				Channel:         channel,
+				Thread:          request.Thread,
+				Platform:        platform,
+				JobParams:       params,
+				Architecture:    architecture,
+			})
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			response.Reply(msg)
+		},
+	})
+
+	command("test <name> <image_or_version_or_pr> <options>", &CommandDefinition{
+		Description: fmt.Sprintf("Run the requested test suite from an image or release or built PRs. Supported test suites are %s. The from argument may be a pull spec of a release image or tags from https://amd64.ocp.releases.ci.openshift.org. ", strings.Join(codeSlice(supportedTests), ", ")),
+		Handler: func(request *ChatRequest, response ChatResponse) {
+			user := request.User
+			channel := request.Channel
+
+			from, err := parseImageInput(request.Param("image_or_version_or_pr"))
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			if len(from) == 0 {
+				response.Reply("you must specify what will be tested")
+				return
+			}
+
+			test := request.Param("name")
+			if len(test) == 0 {
+				response.Reply(fmt.Sprintf("you must specify the name of a test: %s", strings.Join(codeSlice(supportedTests), ", ")))
+			}
+			switch {
+			case contains(supportedTests, test):
+			default:
+				if suggestion := suggest(test, supportedTests); len(suggestion) > 0 {
+					response.Reply(fmt.Sprintf("warning: You are using a custom test name, may not be supported for all platforms, %s", suggestion))
+				} else {
+					response.Reply(fmt.Sprintf("warning: You are using a custom test name, may not be supported for all platforms: %s", strings.Join(codeSlice(supportedTests), ", ")))
+				}
+			}
+
+			platform, architecture, params, err := parseOptions(request.Param("options"))
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+
+			params["test"] = test
+			if strings.Contains(params["test"], "-upgrade") {
+				response.Reply("Upgrade type tests require the 'test upgrade' command")
+				return
+			}
+
+			msg, err := manager.LaunchJobForUser(&JobRequest{
+				OriginalMessage: stripLinks(request.Text),
+				User:            user,
+				Inputs:          [][]string{from},
+				Type:            JobTypeTest,
+				Channel:         channel,
+				Thread:          request.Thread,
+				Platform:        platform,
+				JobParams:       params,
+				Architecture:    architecture,
+			})
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			response.Reply(msg)
+		},
+	})
+
+	command("build <pullrequest>", &CommandDefinition{
+		Description: "Create a new release image from one or more pull requests. The successful build location will be sent to you when it completes and then preserved for 12 hours.  Example: `build openshift/operator-framework-olm#68,operator-framework/operator-marketplace#396`. To obtain a pull secret use `oc registry login --to /path/to/pull-secret` after using `oc login` to login to the relevant CI cluster.",
+		Handler: func(request *ChatRequest, response ChatResponse) {
+			user := request.User
+			channel := request.Channel
+
+			from, err := parseImageInput(request.Param("pullrequest"))
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			if len(from) == 0 {
+				response.Reply("you must specify at least one pull request to build a release image")
+				return
+			}
+
+			platform, architecture, params, err := parseOptions(request.Param("options"))
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+
+			msg, err := manager.LaunchJobForUser(&JobRequest{
+				OriginalMessage: stripLinks(request.Text),
+				User:            user,
+				Inputs:          [][]string{from},
+				Type:            JobTypeBuild,
+				Channel:         channel,
+				Thread:          request.Thread,
+				Platform:        platform,
+				JobParams:       params,
+				Architecture:    architecture,
+			})
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			response.Reply(msg)
+		},
+	})
+
+	command("workflow-launch <name> <image_or_version_or_pr> <parameters>", &CommandDefinition{
+		Description: fmt.Sprintf("Launch a cluster using the requested workflow from an image or release or built PRs. The from argument may be a pull spec of a release image or tags from https://amd64.ocp.releases.ci.openshift.org. "),
+		Handler: func(request *ChatRequest, response ChatResponse) {
+			user := request.User
+			channel := request.Channel
+
+			from, err := parseImageInput(request.Param("image_or_version_or_pr"))
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			if len(from) == 0 {
+				response.Reply("you must specify what will be tested")
+				return
+			}
+
+			name := request.Param("name")
+			if len(name) == 0 {
+				response.Reply(fmt.Sprintf("you must specify the name of a workflow: %s", strings.Join(codeSlice(b.workflowNames()), ", ")))
+				return
+			}
+			platform := ""
+			architecture := "amd64"
+			b.workflowConfig.mutex.RLock()
+			if workflow, ok := b.workflowConfig.Workflows[name]; !ok {
+				b.workflowConfig.mutex.RUnlock()
+				message := fmt.Sprintf("Workflow %s not in workflow list. Please add %s to the workflows list before retrying this command", name, name)
+				if suggestion := suggest(name, b.workflowNames()); len(suggestion) > 0 {
+					message = fmt.Sprintf("Workflow %s not in workflow list, %s If not, please add %s to the workflows list before retrying this command", name, suggestion, name)
+				}
+				response.Reply(message)
+				return
+			} else {
+				platform = workflow.Platform
+				if workflow.Architecture != "" {
+					if contains(supportedArchitectures, workflow.Architecture) {
+						architecture = workflow.Architecture
+					} else {
+						b.workflowConfig.mutex.RUnlock()
+						response.Reply(fmt.Sprintf("Architecture %s not supported by cluster-bot", workflow.Architecture))
+						return
+					}
+				}
+			}
+			b.workflowConfig.mutex.RUnlock()
+
+			params := request.Param("parameters")
+			splitParams := []string{}
+			if len(params) > 0 {
+				splitParams = strings.Split(params, "\",\"")
+				// first item will have a double quote at the beginning
+				splitParams[0] = strings.TrimPrefix(splitParams[0], "\"")
+				// last item will have a double quote at the end
+				splitParams[len(splitParams)-1] = strings.TrimSuffix(splitParams[len(splitParams)-1], "\"")
+			}
+			jobParams := make(map[string]string)
+			for _, combinedParam := range splitParams {
+				split := strings.Split(combinedParam, "=")
+				if len(split) != 2 {
+					response.Reply(fmt.Sprintf("Unable to interpret `%s` as a parameter. Please ensure that all paramters are in the form of KEY=VALUE", combinedParam))
+					return
+				}
+				jobParams[split[0]] = split[1]
+			}
+
+			msg, err := manager.LaunchJobForUser(&JobRequest{
+				OriginalMessage: stripLinks(request.Text),
+				User:            user,
+				Inputs:          [][]string{from},
+				Type:            JobTypeWorkflowLaunch,
+				Channel:         channel,
+				Thread:          request.Thread,
+				Platform:        platform,
+				JobParams:       jobParams,
+				Architecture:    architecture,
+				WorkflowName:    name,
+			})
+			if err != nil {
+				response.Reply(err.Error())
+				return
+			}
+			response.Reply(msg)
+		},
+	})
+
+	command("version", &CommandDefinition{
+		Description: "Report the version of the bot",
+		Handler: func(request *ChatRequest, response ChatResponse) {
+			response.Reply(fmt.Sprintf("Running `%s` from https://github.com/openshift/ci-chat-bot", version.Get().String()))
+		},
+	})
+}
+
+// helpText lists the commands with their descriptions in the same format as the default help of
+// slacker.
+func helpText(commands []*botCommand) string {
+	buf := &strings.Builder{}
+	for _, command := range commands {
+		for _, token := range command.Tokenize() {
+			if token.IsParameter() {
+				fmt.Fprintf(buf, "`%s` ", token.Word)
+			} else {
+				fmt.Fprintf(buf, "*%s* ", token.Word)
+			}
+		}
+		if description := command.Definition().Description; len(description) > 0 {
+			fmt.Fprintf(buf, "- _%s_", description)
+		}
+		fmt.Fprintf(buf, "\n")
+		if example := command.Definition().Example; len(example) > 0 {
+			fmt.Fprintf(buf, ">_*Example:* %s_\n", example)
+		}
+	}
+	return buf.String()
+}
+
+func (b *Bot) jobResponder() func(Job) {
+	return func(job Job) {
+		if len(job.RequestedChannel) == 0 || len(job.RequestedBy) == 0 {
+			klog.Infof("job %q has no requested channel or user, can't notify", job.Name)
+			return
+		}
+		switch job.Mode {
+		case JobTypeLaunch, JobTypeWorkflowLaunch:
+			if job.Phase != JobPhaseReady && job.Phase != JobPhaseFailed {
+				klog.Infof("job is %s, not ready or failed", job.Phase)
+				return
+			}
+		default:
+			if job.Phase == JobPhaseCreating {
+				klog.Infof("job is %s, no URL yet", job.Phase)
+				return
+			}
+		}
+		b.notifyJob(&channelResponse{frontend: b.frontend, channel: job.RequestedChannel, thread: job.RequestedThread}, &job)
+	}
+}
+
+// priorityForUser returns the priority of the user's requests, looking up the members of the
+// configured user groups if the user is not listed directly.
+func (b *Bot) priorityForUser(user string) Priority {
+	if b.priorityConfig == nil {
+		return PriorityNormal
+	}
+	users, groups := b.priorityConfig.Members()
+	if contains(users, user) {
+		return PriorityHigh
+	}
+	for _, group := range groups {
+		members, err := b.frontend.GroupMembers(group)
+		if err != nil {
+			klog.Warningf("Failed to look up members of user group %s: %v", group, err)
+			continue
+		}
+		if contains(members, user) {
+			return PriorityHigh
+		}
+	}
+	return PriorityNormal
+}
+
+func (b *Bot) messageResponder() MessageCallbackFunc {
+	return func(channel, thread, message string, actions ...MessageAction) {
+		(&channelResponse{frontend: b.frontend, channel: channel, thread: thread}).Reply(message, actions...)
+	}
+}
+
+// clusterActions are the actions offered once a cluster is ready. Extending is only offered if
+// extendEnabled is set.
+func clusterActions(job *Job, extendEnabled bool) []MessageAction {
+	actions := []MessageAction{
+		{ID: ActionDone, Label: "Done", Value: jobActionValue(job)},
+		{ID: ActionAuth, Label: "Re-send credentials", Value: jobActionValue(job)},
+	}
+	if extendEnabled && job.TargetType == "steps" {
+		actions = append(actions, MessageAction{ID: ActionExtend, Label: "Extend 1h", Value: jobActionValue(job)})
+	}
+	if len(job.URL) > 0 {
+		actions = append(actions, MessageAction{ID: ActionLogs, Label: "Open logs", Value: job.URL})
+	}
+	return actions
+}
+
+func (b *Bot) notifyJob(response ChatResponse, job *Job) {
+	switch job.Mode {
+	case JobTypeLaunch, JobTypeWorkflowLaunch:
+		cluster := "your cluster"
+		if len(job.ClusterName) > 0 {
+			cluster = fmt.Sprintf("your cluster `%s`", job.ClusterName)
+		}
+		if job.LegacyConfig {
+			response.Reply(fmt.Sprintf("WARNING: using legacy template based job for this cluster. This is unsupported and the cluster may not install as expected. Contact #forum-crt for more information."))
+		}
+		switch {
+		case job.Phase == JobPhaseFailed && len(job.URL) > 0:
+			response.Reply(fmt.Sprintf("%s failed to launch: %s (<%s|logs>)", cluster, job.Failure, job.URL))
+		case job.Phase == JobPhaseFailed:
+			response.Reply(fmt.Sprintf("%s failed to launch: %s", cluster, job.Failure))
+		case job.Phase.Stopped():
+			response.Reply(fmt.Sprintf("%s is %s", cluster, phaseDescription(job)))
+		case (job.Phase != JobPhaseReady || len(job.Credentials) == 0) && len(job.URL) > 0:
+			response.Reply(fmt.Sprintf("cluster is still starting (%s, launched %d minutes ago, <%s|logs>)", phaseDescription(job), time.Now().Sub(job.RequestedAt)/time.Minute, job.URL))
+		case job.Phase != JobPhaseReady || len(job.Credentials) == 0:
+			response.Reply(fmt.Sprintf("cluster is still starting (%s, launched %d minutes ago)", phaseDescription(job), time.Now().Sub(job.RequestedAt)/time.Minute))
+		default:
+			b.sendCredentials(job)
+			if !b.frontend.IsDirectChannel(job.RequestedChannel) {
+				response.Reply(fmt.Sprintf("%s is ready, I sent you the credentials in a direct message", cluster))
+			}
+		}
+		return
+	}
+
+	if len(job.URL) > 0 {
+		switch job.Phase {
+		case JobPhaseFailed:
+			response.Reply(fmt.Sprintf("job <%s|%s> failed", job.URL, job.OriginalMessage))
+			return
+		case JobPhaseSucceeded:
+			response.Reply(fmt.Sprintf("job <%s|%s> succeeded", job.URL, job.OriginalMessage))
+			return
+		}
+	} else {
+		switch job.Phase {
+		case JobPhaseFailed:
+			response.Reply(fmt.Sprintf("job %s failed, but no details could be retrieved", job.OriginalMessage))
+			return
+		case JobPhaseSucceeded:
+			response.Reply(fmt.Sprintf("job %s succeded, but no details could be retrieved", job.OriginalMessage))
+			return
+		}
+	}
+
+	switch {
+	case len(job.Credentials) == 0 && len(job.URL) > 0:
+		if len(job.OriginalMessage) > 0 {
+			response.Reply(fmt.Sprintf("job <%s|%s> is running", job.URL, job.OriginalMessage))
+		} else {
+			response.Reply(fmt.Sprintf("job is running, see %s for details", job.URL))
+		}
+	case len(job.Credentials) == 0:
+		response.Reply(fmt.Sprintf("job is running (launched %d minutes ago)", time.Now().Sub(job.RequestedAt)/time.Minute))
+	default:
+		comment := fmt.Sprintf("Your job has started a cluster, it will be shut down when the test ends.")
+		if len(job.URL) > 0 {
+			comment += fmt.Sprintf(" See %s for details.", job.URL)
+		}
+		channel, err := b.privateChannel(job)
+		if err != nil {
+			klog.Infof("error: unable to send credentials for job %s: %v", job.Name, err)
+			return
+		}
+		b.deliverCredentials(channel, job, comment)
+		if channel != job.RequestedChannel {
+			response.Reply("the job has started a cluster, I sent you the credentials in a direct message")
+		}
+	}
+}
+
+// sendCredentials sends the kubeconfig of a ready cluster to the owner, followed by the actions
+// they can take on the cluster. Credentials are never posted to a channel.
+func (b *Bot) sendCredentials(job *Job) {
+	channel, err := b.privateChannel(job)
+	if err != nil {
+		klog.Infof("error: unable to send credentials for job %s: %v", job.Name, err)
+		return
+	}
+
+	comment := fmt.Sprintf(
+		"Your cluster is ready, it will be shut down automatically in ~%d minutes.",
+		job.ExpiresAt.Sub(time.Now())/time.Minute,
+	)
+	if len(job.ClusterName) > 0 {
+		comment = fmt.Sprintf(
+			"Your cluster `%s` is ready, it will be shut down automatically in ~%d minutes.",
+			job.ClusterName,
+			job.ExpiresAt.Sub(time.Now())/time.Minute,
+		)
+	}
+	b.deliverCredentials(channel, job, comment)
+
+	if _, _, err := b.frontend.PostMessage(channel, "", "Manage your cluster:", clusterActions(job, b.extendEnabled)...); err != nil {
+		klog.Infof("error: unable to send cluster actions: %v", err)
+	}
+}
+
+// deliverCredentials sends the kubeconfig and login details of a cluster to a private channel, as a
+// file or, if credential links are enabled, as a one-time link so they are not kept in the chat.
+func (b *Bot) deliverCredentials(channel string, job *Job, comment string) {
+	if b.credentials == nil {
+		if len(job.PasswordSnippet) > 0 {
+			comment += "\n" + job.PasswordSnippet
+		}
+		b.sendKubeconfig(channel, job.Credentials, comment, job.RequestedAt.Format("2006-01-02-150405"))
+		return
+	}
+	link, err := b.credentials.Add(job, time.Now())
+	if err != nil {
+		klog.Infof("error: unable to create credential link for job %s: %v", job.Name, err)
+		return
+	}
+	comment += fmt.Sprintf("\nGet the kubeconfig and kubeadmin password from <%s|this link>. It can only be opened once and stops working when the cluster shuts down.", link)
+	if _, _, err := b.frontend.PostMessage(channel, "", comment); err != nil {
+		klog.Infof("error: unable to send credential link: %v", err)
+	}
+}
+
+func (b *Bot) sendKubeconfig(channel, contents, comment, identifier string) {
+	if err := b.frontend.UploadFile(channel, fmt.Sprintf("cluster-bot-%s.kubeconfig", identifier), contents, comment); err != nil {
+		klog.Infof("error: unable to send attachment with message: %v", err)
+		return
+	}
+	klog.Infof("successfully uploaded file to %s", channel)
+}
+
+// privateChannel returns the channel to send the job's credentials to: the channel of the request
+// if it was a direct message, otherwise a direct message with the user who requested the job.
+func (b *Bot) privateChannel(job *Job) (string, error) {
+	if b.frontend.IsDirectChannel(job.RequestedChannel) {
+		return job.RequestedChannel, nil
+	}
+	channel, err := b.frontend.PrivateChannel(job.RequestedBy)
+	if err != nil {
+		return "", fmt.Errorf("unable to open a direct message with %s: %v", job.RequestedBy, err)
+	}
+	return channel, nil
+}
+
+func codeSlice(items []string) []string {
+	code := make([]string, 0, len(items))
+	for _, item := range items {
+		code = append(code, fmt.Sprintf("`%s`", item))
+	}
+	return code
+}
+
+func parseImageInput(input string) ([]string, error) {
+	input = strings.TrimSpace(input)
+	if len(input) == 0 {
+		return nil, nil
+	}
+	input = stripLinks(input)
+	parts := strings.Split(input, ",")
+	for _, part := range parts {
+		if len(part) == 0 {
+			return nil, fmt.Errorf("image inputs must not contain empty items")
+		}
+	}
+	return parts, nil
+}
+
+func stripLinks(input string) string {
+	var b strings.Builder
+	for {
+		open := strings.Index(input, "<")
+		if open == -1 {
+			b.WriteString(input)
+			break
+		}
+		close := strings.Index(input[open:], ">")
+		if close == -1 {
+			b.WriteString(input)
+			break
+		}
+		pipe := strings.Index(input[open:], "|")
+		if pipe == -1 || pipe > close {
+			b.WriteString(input[0:open])
+			b.WriteString(input[open+1 : open+close])
+			input = input[open+close+1:]
+			continue
+		}
+		b.WriteString(input[0:open])
+		b.WriteString(input[open+pipe+1 : open+close])
+		input = input[open+close+1:]
+	}
+	return b.String()
+}
+
+// launchSettings are the key=value arguments of the launch command that describe the cluster
+// itself rather than a variant of the job.
+var launchSettings = []string{"name", "lifetime"}
+
+// reClusterName restricts cluster names to short, lowercase, dash separated words.
+var reClusterName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,18}[a-z0-9])?$`)
+
+// parseLaunchArguments separates the launch settings from the image and options arguments of the
+// launch command. Settings may be given as separate arguments (`launch 4.10 aws name=old`) or as
+// part of the options list (`launch 4.10 aws,name=old`).
+func parseLaunchArguments(args ...string) (string, string, map[string]string, error) {
+	settings := make(map[string]string)
+	var positional []string
+	for _, field := range strings.Fields(strings.Join(args, " ")) {
+		var kept []string
+		for _, part := range strings.Split(field, ",") {
+			parts := strings.SplitN(part, "=", 2)
+			if len(parts) == 2 && contains(launchSettings, parts[0]) {
+				if _, ok := settings[parts[0]]; ok {
+					return "", "", nil, fmt.Errorf("you may only specify %s once", parts[0])
+				}
+				settings[parts[0]] = parts[1]
+				continue
+			}
+			kept = append(kept, part)
+		}
+		if len(kept) > 0 {
+			positional = append(positional, strings.Join(kept, ","))
+		}
+	}
+	if len(positional) > 2 {
+		return "", "", nil, fmt.Errorf("unexpected argument `%s`, options must be separated by commas", positional[2])
+	}
+	if name, ok := settings["name"]; ok && !reClusterName.MatchString(name) {
+		return "", "", nil, fmt.Errorf("cluster names must be at most 20 lowercase letters, digits or dashes")
+	}
+	var imageOrVersion, options string
+	if len(positional) > 0 {
+		imageOrVersion = positional[0]
+	}
+	if len(positional) > 1 {
+		options = positional[1]
+	}
+	return imageOrVersion, options, settings, nil
+}
+
+// withDefaultPlatform adds the default platform of a user to the options of a launch unless the
+// options name a platform.
+func withDefaultPlatform(options, platform string) string {
+	if len(platform) == 0 {
+		return options
+	}
+	for _, opt := range strings.Split(options, ",") {
+		if contains(supportedPlatforms, strings.TrimSpace(opt)) {
+			return options
+		}
+	}
+	if len(strings.TrimSpace(options)) == 0 {
+		return platform
+	}
+	return platform + "," + options
+}
+
+// parseSettings applies `name=value` pairs, separated by commas or spaces, to the settings of a user.
+func parseSettings(settings UserSettings, value string) (UserSettings, error) {
+	fields := strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+	for _, field := range fields {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return settings, fmt.Errorf("settings are changed with `name=value`, e.g. `platform=aws`")
+		}
+		switch parts[0] {
+		case "platform":
+			if len(parts[1]) > 0 && !contains(supportedPlatforms, parts[1]) {
+				if suggestion := suggest(parts[1], supportedPlatforms); len(suggestion) > 0 {
+					return settings, fmt.Errorf("unrecognized platform: %s, %s", parts[1], suggestion)
+				}
+				return settings, fmt.Errorf("unrecognized platform: %s, must be one of %s", parts[1], strings.Join(codeSlice(supportedPlatforms), ", "))
+			}
+			settings.Platform = parts[1]
+		default:
+			if suggestion := suggest(parts[0], []string{"platform"}); len(suggestion) > 0 {
+				return settings, fmt.Errorf("unrecognized setting: %s, %s", parts[0], suggestion)
+			}
+			return settings, fmt.Errorf("unrecognized setting: %s, the only setting is `platform`", parts[0])
+		}
+	}
+	return settings, nil
+}
+
+// newLaunchRequest creates the request for a cluster from the arguments of the launch command.
+// The caller fills in who requested it and where.
+func newLaunchRequest(imageOrVersion, options string, settings map[string]string) (*JobRequest, error) {
+	from, err := parseImageInput(imageOrVersion)
+	if err != nil {
+		return nil, err
+	}
+	var inputs [][]string
+	if len(from) > 0 {
+		inputs = [][]string{from}
+	}
+
+	platform, architecture, params, err := parseOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	if len(params["test"]) > 0 {
+		return nil, fmt.Errorf("Test arguments may not be passed from the launch command")
+	}
+	var lifetime time.Duration
+	if value, ok := settings["lifetime"]; ok {
+		if lifetime, err = time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("the lifetime must be a duration like `24h`")
+		}
+	}
+	return &JobRequest{
+		Inputs:       inputs,
+		Type:         JobTypeInstall,
+		Platform:     platform,
+		JobParams:    params,
+		Architecture: architecture,
+		ClusterName:  settings["name"],
+		Lifetime:     lifetime,
+	}, nil
+}
+
+func parseOptions(options string) (string, string, map[string]string, error) {
+	params, err := paramsFromAnnotation(options)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("options could not be parsed: %v", err)
+	}
+	var platform, architecture string
+	for opt := range params {
+		switch {
+		case contains(supportedPlatforms, opt):
+			if len(platform) > 0 {
+				return "", "", nil, fmt.Errorf("you may only specify one platform in options")
+			}
+			platform = opt
+			delete(params, opt)
+		case contains(supportedArchitectures, opt):
+			if len(architecture) > 0 {
+				return "", "", nil, fmt.Errorf("you may only specify one architecture in options")
+			}
+			architecture = opt
+			delete(params, opt)
+		case opt == "":
+			delete(params, opt)
+		case contains(supportedParameters, opt):
+			// do nothing
+		default:
+			if suggestion := suggest(opt, append(append(append([]string{}, supportedPlatforms...), supportedArchitectures...), supportedParameters...)); len(suggestion) > 0 {
+				return "", "", nil, fmt.Errorf("unrecognized option: %s, %s", opt, suggestion)
+			}
+			return "", "", nil, fmt.Errorf("unrecognized option: %s", opt)
+		}
+	}
+	if len(platform) == 0 {
+		platform = "gcp"
+	}
+	if len(architecture) == 0 {
+		architecture = "amd64"
+	}
+	return platform, architecture, params, nil
+}
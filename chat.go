@@ -0,0 +1,114 @@
+package main
+
+import (
+	"github.com/shomali11/commander"
+	"github.com/shomali11/proper"
+	"k8s.io/klog"
+)
+
+// ChatFrontend connects the bot to a chat service. Messages are written in Slack's markup, other
+// frontends translate it to their own.
+type ChatFrontend interface {
+	// Listen receives commands and passes them to the bot until the connection to the chat service
+	// is lost.
+	Listen(bot *Bot, manager JobManager) error
+	// PostMessage delivers a message to a channel, in a thread of it if thread is set. If the channel
+	// is a user ID the message is delivered as a direct message to that user. Actions are offered
+	// alongside the message where the chat service supports them. The channel and ID of the posted
+	// message are returned so it can be updated.
+	PostMessage(channel, thread, message string, actions ...MessageAction) (string, string, error)
+	// UpdateMessage replaces the text of a message that was posted by the bot.
+	UpdateMessage(channel, id, message string) error
+	// UploadFile posts a file with a comment to a channel.
+	UploadFile(channel, filename, contents, comment string) error
+	// PrivateChannel returns the channel of the direct conversation between the bot and a user.
+	PrivateChannel(user string) (string, error)
+	// IsDirectChannel reports whether a channel is a direct conversation with the bot.
+	IsDirectChannel(channel string) bool
+	// GroupMembers returns the users in a user group.
+	GroupMembers(group string) ([]string, error)
+}
+
+// ChatRequest is a command a user sent to the bot. The text no longer contains the mention of the
+// bot the command may have been addressed with.
+type ChatRequest struct {
+	User    string
+	Channel string
+	// Thread is set if the command was sent in a channel, it is answered in the thread
+	Thread string
+	// SentIn is set if the command was sent in another channel than the one messages about it go
+	// to, like slash commands whose follow-ups are sent to the user directly
+	SentIn string
+	Text   string
+
+	params *proper.Properties
+}
+
+// SourceChannel returns the channel the command was sent in.
+func (r *ChatRequest) SourceChannel() string {
+	if len(r.SentIn) > 0 {
+		return r.SentIn
+	}
+	return r.Channel
+}
+
+// Param returns the value of a parameter of the command, or the empty string if it was omitted.
+func (r *ChatRequest) Param(name string) string {
+	if r.params == nil {
+		return ""
+	}
+	return r.params.StringParam(name, "")
+}
+
+// ChatResponse answers a command.
+type ChatResponse interface {
+	Reply(message string, actions ...MessageAction)
+}
+
+// channelResponse answers in a channel, or in a thread of it, through a frontend.
+type channelResponse struct {
+	frontend ChatFrontend
+	channel  string
+	thread   string
+}
+
+func (r *channelResponse) Reply(message string, actions ...MessageAction) {
+	if _, _, err := r.frontend.PostMessage(r.channel, r.thread, message, actions...); err != nil {
+		klog.Warningf("Failed to send message to %s: %v", r.channel, err)
+	}
+}
+
+// CommandDefinition describes a command of the bot and handles it.
+type CommandDefinition struct {
+	Description string
+	Example     string
+	Handler     func(request *ChatRequest, response ChatResponse)
+}
+
+// botCommand matches messages against the usage of a command, e.g. `extend <duration> <name>`.
+// Parameters are optional and the last one takes the rest of the message.
+type botCommand struct {
+	usage      string
+	definition *CommandDefinition
+	command    *commander.Command
+}
+
+func newBotCommand(usage string, definition *CommandDefinition) *botCommand {
+	return &botCommand{
+		usage:      usage,
+		definition: definition,
+		command:    commander.NewCommand(usage),
+	}
+}
+
+func (c *botCommand) Match(text string) (*proper.Properties, bool) {
+	return c.command.Match(text)
+}
+
+func (c *botCommand) Tokenize() []*commander.Token {
+	return c.command.Tokenize()
+}
+
+func (c *botCommand) Definition() *CommandDefinition {
+	return c.definition
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// defaultCredentialLinkLifetime is how long a credential link stays valid for clusters without an
+// expiration time, such as the clusters of test jobs.
+const defaultCredentialLinkLifetime = 4 * time.Hour
+
+// credentialStore serves the credentials of clusters behind random one-time links, so the kubeconfig
+// and kubeadmin password never end up in the Slack history. A link stops working once it has been
+// opened or when the cluster expires, whichever happens first. Links are kept in memory and do not
+// survive a restart of the bot, the owner can ask for the credentials again with `auth`.
+type credentialStore struct {
+	baseURL string
+
+	lock  sync.Mutex
+	links map[string]*credentialLink
+}
+
+type credentialLink struct {
+	name       string
+	kubeconfig string
+	snippet    string
+	expiresAt  time.Time
+}
+
+func newCredentialStore(baseURL string) *credentialStore {
+	return &credentialStore{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		links:   make(map[string]*credentialLink),
+	}
+}
+
+// Add registers the credentials of a job and returns the link they can be retrieved from once.
+func (s *credentialStore) Add(job *Job, now time.Time) (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", fmt.Errorf("unable to generate a credential link: %v", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(data)
+
+	expiresAt := job.ExpiresAt
+	if expiresAt.IsZero() {
+		expiresAt = now.Add(defaultCredentialLinkLifetime)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for token, link := range s.links {
+		if !link.expiresAt.After(now) {
+			delete(s.links, token)
+		}
+	}
+	s.links[token] = &credentialLink{
+		name:       fmt.Sprintf("cluster-bot-%s.kubeconfig", job.RequestedAt.Format("2006-01-02-150405")),
+		kubeconfig: job.Credentials,
+		snippet:    job.PasswordSnippet,
+		expiresAt:  expiresAt,
+	}
+	return fmt.Sprintf("%s/credentials/%s", s.baseURL, token), nil
+}
+
+// redeem returns the credentials behind a token and forgets them.
+func (s *credentialStore) redeem(token string, now time.Time) (*credentialLink, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	link, ok := s.links[token]
+	if !ok {
+		return nil, false
+	}
+	delete(s.links, token)
+	if !link.expiresAt.After(now) {
+		return nil, false
+	}
+	return link, true
+}
+
+// exists reports whether a token can still be redeemed.
+func (s *credentialStore) exists(token string, now time.Time) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	link, ok := s.links[token]
+	return ok && link.expiresAt.After(now)
+}
+
+var credentialPage = template.Must(template.New("credentials").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Cluster credentials</title></head>
+<body>
+{{- if .Missing }}
+<p>This link has already been used or has expired. Ask the bot for the credentials again with <code>auth</code>.</p>
+{{- else if .Kubeconfig }}
+<p><a download="{{ .Name }}" href="{{ .Download }}">Download the kubeconfig</a></p>
+<pre>{{ .Snippet }}</pre>
+<pre>{{ .Kubeconfig }}</pre>
+<p>This link no longer works, save the credentials now.</p>
+{{- else }}
+<form method="POST">
+<p>The credentials can only be shown once.</p>
+<input type="submit" value="Show the credentials">
+</form>
+{{- end }}
+</body>
+</html>
+`))
+
+// ServeHTTP shows a confirmation on GET and reveals the credentials on POST, so that link previews
+// and scanners that follow the link do not use it up.
+func (s *credentialStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, "/credentials/")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	var page struct {
+		Missing    bool
+		Name       string
+		Download   template.URL
+		Snippet    string
+		Kubeconfig string
+	}
+	switch r.Method {
+	case http.MethodGet:
+		page.Missing = !s.exists(token, time.Now())
+	case http.MethodPost:
+		link, ok := s.redeem(token, time.Now())
+		if ok {
+			klog.Infof("credential link for %s was used", link.name)
+			page.Name = link.name
+			page.Download = template.URL("data:text/plain;base64," + base64.StdEncoding.EncodeToString([]byte(link.kubeconfig)))
+			page.Snippet = link.snippet
+			page.Kubeconfig = link.kubeconfig
+		}
+		page.Missing = !ok
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if page.Missing {
+		w.WriteHeader(http.StatusNotFound)
+	}
+	if err := credentialPage.Execute(w, page); err != nil {
+		klog.Infof("error: unable to render credential page: %v", err)
+	}
+}
+
+// Serve listens for requests for credential links. Without a certificate the endpoint is served over
+// plain HTTP, which is only suitable behind a proxy or route that terminates TLS.
+func (s *credentialStore) Serve(address, certFile, keyFile string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/credentials/", s)
+	klog.Infof("serving credential links for %s on %s", s.baseURL, address)
+	if len(certFile) > 0 {
+		return http.ListenAndServeTLS(address, certFile, keyFile, mux)
+	}
+	return http.ListenAndServe(address, mux)
+}
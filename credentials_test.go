@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCredentialLinks(t *testing.T) {
+	type request struct {
+		method string
+		status int
+		// revealed is set if the credentials must be on the page
+		revealed bool
+	}
+	testCases := []struct {
+		name     string
+		expires  time.Duration
+		token    string
+		requests []request
+	}{
+		{
+			name:    "the link works once",
+			expires: time.Hour,
+			requests: []request{
+				{method: http.MethodPost, status: http.StatusOK, revealed: true},
+				{method: http.MethodPost, status: http.StatusNotFound},
+				{method: http.MethodGet, status: http.StatusNotFound},
+			},
+		},
+		{
+			name:    "GET does not use up the link",
+			expires: time.Hour,
+			requests: []request{
+				{method: http.MethodGet, status: http.StatusOK},
+				{method: http.MethodGet, status: http.StatusOK},
+				{method: http.MethodPost, status: http.StatusOK, revealed: true},
+			},
+		},
+		{
+			name:    "an expired link is not found",
+			expires: -time.Minute,
+			requests: []request{
+				{method: http.MethodGet, status: http.StatusNotFound},
+				{method: http.MethodPost, status: http.StatusNotFound},
+			},
+		},
+		{
+			name:    "an unknown token is not found",
+			expires: time.Hour,
+			token:   "unknown",
+			requests: []request{
+				{method: http.MethodGet, status: http.StatusNotFound},
+				{method: http.MethodPost, status: http.StatusNotFound},
+			},
+		},
+		{
+			name:    "other methods are rejected",
+			expires: time.Hour,
+			requests: []request{
+				{method: http.MethodDelete, status: http.StatusMethodNotAllowed},
+				{method: http.MethodPost, status: http.StatusOK, revealed: true},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newCredentialStore("https://bot.example.com/")
+			now := time.Now()
+			job := &Job{
+				Credentials:     "apiVersion: v1\nkind: Config\n",
+				PasswordSnippet: "kubeadmin password: secret",
+				RequestedAt:     now.Add(-2 * time.Hour),
+				ExpiresAt:       now.Add(tc.expires),
+			}
+			// the link is added before it expired
+			link, err := store.Add(job, now.Add(-time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(link, "https://bot.example.com/credentials/") {
+				t.Fatalf("unexpected link %q", link)
+			}
+			path := strings.TrimPrefix(link, "https://bot.example.com")
+			if len(tc.token) > 0 {
+				path = "/credentials/" + tc.token
+			}
+
+			for i, req := range tc.requests {
+				recorder := httptest.NewRecorder()
+				store.ServeHTTP(recorder, httptest.NewRequest(req.method, path, nil))
+				if recorder.Code != req.status {
+					t.Errorf("request %d: expected status %d, got %d", i, req.status, recorder.Code)
+				}
+				body := recorder.Body.String()
+				if revealed := strings.Contains(body, "kubeadmin password: secret"); revealed != req.revealed {
+					t.Errorf("request %d: expected credentials revealed to be %t, got page:\n%s", i, req.revealed, body)
+				}
+				if got := recorder.Header().Get("Cache-Control"); got != "no-store" {
+					t.Errorf("request %d: expected the page not to be cached, got Cache-Control %q", i, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCredentialStorePrunesExpiredLinks(t *testing.T) {
+	store := newCredentialStore("https://bot.example.com")
+	now := time.Now()
+	for _, expiresAt := range []time.Time{now.Add(-time.Hour), now.Add(-time.Minute), now.Add(time.Hour)} {
+		if _, err := store.Add(&Job{ExpiresAt: expiresAt}, now.Add(-2*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(store.links) != 3 {
+		t.Fatalf("expected 3 links before they expired, got %d", len(store.links))
+	}
+	if _, err := store.Add(&Job{}, now); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.links) != 2 {
+		t.Errorf("expected the 2 expired links to be pruned, %d links are left", len(store.links))
+	}
+	for _, link := range store.links {
+		if !link.expiresAt.After(now) {
+			t.Errorf("expired link %s was kept", link.name)
+		}
+	}
+}
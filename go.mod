@@ -23,12 +23,14 @@ replace (
 require (
 	github.com/blang/semver v3.5.1+incompatible
 	github.com/elazarl/goproxy v0.0.0-20200315184450-1f3cb6622dad // indirect
+	github.com/gorilla/websocket v1.4.2
 	github.com/openshift/api v0.0.0-20210730095913-85e1d547cdee
 	github.com/openshift/ci-tools v0.0.0-20220203161918-dbab1f148fc5
 	github.com/openshift/client-go v3.9.0+incompatible
 	github.com/sbstjn/allot v0.0.0-20161025071122-1f2349af5ccd // indirect
 	github.com/sbstjn/hanu v0.1.0
-	github.com/shomali11/proper v0.0.0-20190608032528-6e70a05688e7 // indirect
+	github.com/shomali11/commander v0.0.0-20191122162317-51bc574c29ba
+	github.com/shomali11/proper v0.0.0-20190608032528-6e70a05688e7
 	github.com/shomali11/slacker v0.0.0-20200420173605-4887ab8127b6
 	github.com/slack-go/slack v0.7.3
 	github.com/spf13/pflag v1.0.5
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// commandExamples are the worked examples `help <command>` shows for each command, by command name.
+var commandExamples = map[string][]string{
+	"launch": {
+		"`launch` - the latest CI build on gcp",
+		"`launch 4.10 aws` - the next stable 4.10 version on aws",
+		"`launch nightly azure,ovn` - the latest nightly on azure with the OVN network plugin",
+		"`launch openshift/installer#123,openshift/origin#456 aws` - a release with two pull requests built in",
+		"`launch 4.10 gcp name=demo lifetime=24h` - a second cluster that runs for a day once approved",
+	},
+	"test": {
+		"`test e2e 4.10 aws` - the e2e suite against 4.10 on aws",
+		"`test e2e-serial openshift/origin#123 gcp` - the serial suite against a pull request",
+	},
+	"test upgrade": {
+		"`test upgrade 4.9 4.10 aws` - upgrade from 4.9 to 4.10 on aws",
+		"`test upgrade 4.10 openshift/cluster-version-operator#789 gcp,test=e2e-upgrade-all` - upgrade to a pull request and run all tests",
+	},
+	"workflow-launch": {
+		"`workflow-launch openshift-e2e-gcp 4.10` - a cluster launched with a workflow",
+		"`workflow-launch openshift-e2e-gcp 4.10 \"KEY=VALUE\",\"OTHER=VALUE\"` - passing parameters to the workflow",
+	},
+	"extend": {
+		"`extend 90m` - keep your only cluster for 90 more minutes",
+		"`extend 2h demo` - keep the cluster named `demo` for 2 more hours",
+	},
+	"done": {
+		"`done` - shut down your only cluster",
+		"`done demo` - shut down the cluster named `demo`",
+	},
+	"build": {
+		"`build openshift/operator-framework-olm#68,operator-framework/operator-marketplace#396` - a release with two pull requests built in",
+	},
+	"lookup": {
+		"`lookup 4.10` - the version `launch 4.10` would use",
+		"`lookup openshift/origin#123` - what a pull request would be built on",
+	},
+	"settings": {
+		"`settings platform=aws` - launch on aws unless a launch names a platform",
+		"`settings platform=` - launch on gcp again",
+	},
+	"reserve": {
+		"`reserve 2 aws 2026-11-03T14:00 3h` - two aws clusters for a three hour session",
+	},
+}
+
+// allowedValues lists the values currently accepted by the arguments of a command.
+func (b *Bot) allowedValues(name string) []string {
+	values := func(title string, items []string) string {
+		return fmt.Sprintf("%s: %s", title, strings.Join(codeSlice(items), ", "))
+	}
+	switch name {
+	case "launch":
+		return []string{values("Platforms", supportedPlatforms), values("Architectures", supportedArchitectures), values("Variants", supportedParameters)}
+	case "test":
+		return []string{values("Tests", supportedTests), values("Platforms", supportedPlatforms), values("Variants", supportedParameters)}
+	case "test upgrade":
+		return []string{values("Tests", supportedUpgradeTests), values("Platforms", supportedPlatforms), values("Variants", supportedParameters)}
+	case "workflow-launch":
+		return []string{values("Workflows", b.workflowNames())}
+	case "reserve":
+		return []string{values("Platforms", supportedPlatforms)}
+	}
+	return nil
+}
+
+// workflowNames returns the names of the configured workflows in order.
+func (b *Bot) workflowNames() []string {
+	b.workflowConfig.mutex.RLock()
+	defer b.workflowConfig.mutex.RUnlock()
+	var names []string
+	for name := range b.workflowConfig.Workflows {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// helpDefinition defines the help command, which lists all commands or, as `help <command>`, shows the
+// full grammar, examples and allowed values of one command.
+func (b *Bot) helpDefinition() *CommandDefinition {
+	return &CommandDefinition{
+		Description: "List the commands, or use `help <command>` for the details of a command.",
+		Example:     "help launch",
+		Handler: func(request *ChatRequest, response ChatResponse) {
+			words := strings.Fields(request.Text)
+			for len(words) > 0 && !strings.EqualFold(words[0], "help") {
+				words = words[1:]
+			}
+			if len(words) < 2 {
+				response.Reply(helpText(b.commands))
+				return
+			}
+			name := strings.ToLower(strings.Join(words[1:], " "))
+			for _, command := range b.commands {
+				if commandName(command) == name {
+					response.Reply(b.commandHelp(command))
+					return
+				}
+			}
+			var names []string
+			for _, command := range b.commands {
+				names = append(names, commandName(command))
+			}
+			message := fmt.Sprintf("there is no command `%s`", name)
+			if suggestion := suggest(name, names); len(suggestion) > 0 {
+				message += ", " + suggestion
+			}
+			response.Reply(message)
+		},
+	}
+}
+
+// commandHelp describes a command in full.
+func (b *Bot) commandHelp(command *botCommand) string {
+	buf := &strings.Builder{}
+	buf.WriteString(helpText([]*botCommand{command}))
+	name := commandName(command)
+	if examples := commandExamples[name]; len(examples) > 0 {
+		buf.WriteString("*Examples:*\n")
+		for _, example := range examples {
+			fmt.Fprintf(buf, "• %s\n", example)
+		}
+	}
+	if values := b.allowedValues(name); len(values) > 0 {
+		buf.WriteString("*Allowed values:*\n")
+		for _, value := range values {
+			fmt.Fprintf(buf, "• %s\n", value)
+		}
+	}
+	return buf.String()
+}
+
+// commandName returns the words of a command that come before its parameters, e.g. `test upgrade`.
+func commandName(command *botCommand) string {
+	var words []string
+	for _, token := range command.Tokenize() {
+		if token.IsParameter() {
+			break
+		}
+		words = append(words, token.Word)
+	}
+	return strings.Join(words, " ")
+}
+
+// unrecognizedCommand is the reply to a message that matches no command.
+func unrecognizedCommand(text string, commands []*botCommand) string {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return "unrecognized command, msg me `help` for a list of all commands"
+	}
+	var names []string
+	for _, command := range commands {
+		names = append(names, strings.Fields(commandName(command))[0])
+	}
+	if suggestion := suggest(words[0], names); len(suggestion) > 0 {
+		return fmt.Sprintf("unrecognized command `%s`, %s Msg me `help` for a list of all commands", words[0], suggestion)
+	}
+	return "unrecognized command, msg me `help` for a list of all commands"
+}
+
+// suggest returns "did you mean ...?" with the candidates closest to a mistyped word, or an empty
+// string if none of them are close enough to be what the user meant.
+func suggest(word string, candidates []string) string {
+	word = strings.ToLower(word)
+	// allow one typo for every three characters
+	best := len(word)/3 + 1
+	var matches []string
+	for _, candidate := range candidates {
+		distance := editDistance(word, strings.ToLower(candidate))
+		switch {
+		case distance > best:
+		case distance < best:
+			best = distance
+			matches = []string{candidate}
+		case !contains(matches, candidate):
+			matches = append(matches, candidate)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return ""
+	case 1:
+		return fmt.Sprintf("did you mean `%s`?", matches[0])
+	}
+	sort.Strings(matches)
+	if len(matches) > 3 {
+		matches = matches[:3]
+	}
+	return fmt.Sprintf("did you mean %s or `%s`?", strings.Join(codeSlice(matches[:len(matches)-1]), ", "), matches[len(matches)-1])
+}
+
+// editDistance counts the insertions, deletions, substitutions and swaps of adjacent characters that
+// turn a into b.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+func minInt(first int, rest ...int) int {
+	for _, value := range rest {
+		if value < first {
+			first = value
+		}
+	}
+	return first
+}
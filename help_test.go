@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestSuggest(t *testing.T) {
+	commands := []string{"help", "launch", "lookup", "list", "refresh", "done", "auth", "test", "build", "workflow-launch", "quota", "history", "settings", "reserve", "reservations", "unreserve"}
+	workflows := []string{"openshift-e2e-aws", "openshift-e2e-gcp", "openshift-e2e-azure-ovn"}
+	testCases := []struct {
+		name       string
+		word       string
+		candidates []string
+		expected   string
+	}{
+		{name: "misspelled command", word: "lauch", candidates: commands, expected: "did you mean `launch`?"},
+		{name: "capitalized command", word: "Refesh", candidates: commands, expected: "did you mean `refresh`?"},
+		{name: "swapped platform letters", word: "gpc", candidates: supportedPlatforms, expected: "did you mean `gcp`?"},
+		{name: "misspelled test", word: "e2e-seral", candidates: supportedTests, expected: "did you mean `e2e-serial`?"},
+		{name: "misspelled upgrade test", word: "e2e-upgrade-al", candidates: supportedUpgradeTests, expected: "did you mean `e2e-upgrade-all`?"},
+		{name: "misspelled workflow", word: "openshift-e2e-gpc", candidates: workflows, expected: "did you mean `openshift-e2e-gcp`?"},
+		{name: "closest of several close commands", word: "reserv", candidates: commands, expected: "did you mean `reserve`?"},
+		{name: "several equally close candidates", word: "e2e-x", candidates: []string{"e2e-a", "e2e-b", "e2e-c", "e2e-d"}, expected: "did you mean `e2e-a`, `e2e-b` or `e2e-c`?"},
+		{name: "two equally close candidates", word: "e2e-x", candidates: []string{"e2e-b", "e2e-a", "e2e"}, expected: "did you mean `e2e-a` or `e2e-b`?"},
+		{name: "nothing close", word: "kubernetes", candidates: commands},
+		{name: "too many typos for a short word", word: "xyz", candidates: supportedPlatforms},
+		{name: "no candidates", word: "launch"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := suggest(tc.word, tc.candidates); actual != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected int
+	}{
+		{a: "aws", b: "aws", expected: 0},
+		{a: "", b: "gcp", expected: 3},
+		{a: "gcp", b: "", expected: 3},
+		{a: "gcp", b: "gpc", expected: 1},
+		{a: "lauch", b: "launch", expected: 1},
+		{a: "launchh", b: "launch", expected: 1},
+		{a: "kitten", b: "sitting", expected: 3},
+		{a: "métal", b: "metal", expected: 1},
+	}
+	for _, tc := range testCases {
+		if actual := editDistance(tc.a, tc.b); actual != tc.expected {
+			t.Errorf("editDistance(%q, %q): expected %d, got %d", tc.a, tc.b, tc.expected, actual)
+		}
+	}
+}
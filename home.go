@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+	"k8s.io/klog"
+)
+
+// actionLaunchForm opens the launch form from a button.
+const actionLaunchForm = "launch_form"
+
+// homeView renders the App Home tab of a user: their clusters and jobs with the actions they can
+// take on them, the ones that finished recently, and the overall capacity.
+func homeView(jobs []Job, quota, capacity string, extendEnabled bool, now time.Time) slack.HomeTabViewRequest {
+	markdown := func(text string) slack.Block {
+		return slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil)
+	}
+
+	var clusters, running, recent []Job
+	for _, job := range jobs {
+		switch {
+		case job.Phase.Stopped():
+			recent = append(recent, job)
+		case job.Mode == JobTypeLaunch || job.Mode == JobTypeWorkflowLaunch:
+			clusters = append(clusters, job)
+		default:
+			running = append(running, job)
+		}
+	}
+
+	blocks := []slack.Block{markdown("*Your clusters*")}
+	if len(clusters) == 0 {
+		blocks = append(blocks, markdown("You have no clusters running."))
+	}
+	for i := range clusters {
+		job := &clusters[i]
+		blocks = append(blocks, actionBlocks(homeClusterStatus(job, now), clusterActions(job, extendEnabled))...)
+	}
+	launch := slack.NewButtonBlockElement(actionLaunchForm, "", slack.NewTextBlockObject(slack.PlainTextType, "Launch a cluster", false, false))
+	blocks = append(blocks, slack.NewActionBlock("", launch.WithStyle(slack.StylePrimary)))
+
+	if len(running) > 0 {
+		blocks = append(blocks, slack.NewDividerBlock(), markdown("*Your jobs*"))
+		for i := range running {
+			job := &running[i]
+			status := fmt.Sprintf("%s - %s, %d minutes elapsed", job.OriginalMessage, phaseDescription(job), int(now.Sub(job.RequestedAt)/time.Minute))
+			if len(job.URL) == 0 {
+				blocks = append(blocks, markdown(status))
+				continue
+			}
+			blocks = append(blocks, actionBlocks(status, []MessageAction{{ID: ActionLogs, Label: "Open logs", Value: job.URL}})...)
+		}
+	}
+
+	if len(recent) > 0 {
+		var lines []string
+		for i := range recent {
+			lines = append(lines, "• "+homeRecentStatus(&recent[i]))
+		}
+		blocks = append(blocks, slack.NewDividerBlock(), markdown("*Recently finished*\n"+strings.Join(lines, "\n")))
+	}
+
+	blocks = append(blocks,
+		slack.NewDividerBlock(),
+		markdown("*Capacity*\n"+capacity),
+		slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, strings.ToUpper(quota[:1])+quota[1:], false, false)),
+	)
+	return slack.HomeTabViewRequest{
+		Type:   slack.VTHomeTab,
+		Blocks: slack.Blocks{BlockSet: blocks},
+	}
+}
+
+// homeClusterStatus describes a running or starting cluster.
+func homeClusterStatus(job *Job, now time.Time) string {
+	name := "Cluster"
+	if len(job.ClusterName) > 0 {
+		name = fmt.Sprintf("`%s`", job.ClusterName)
+	}
+	var status string
+	switch {
+	case job.Phase == JobPhaseReady:
+		status = fmt.Sprintf("available, shut down in %d minutes", int(job.ExpiresAt.Sub(now)/time.Minute))
+	case len(job.URL) > 0:
+		status = fmt.Sprintf("starting (%s), %d minutes elapsed (<%s|logs>)", phaseDescription(job), int(now.Sub(job.RequestedAt)/time.Minute), job.URL)
+	default:
+		status = fmt.Sprintf("starting (%s), %d minutes elapsed", phaseDescription(job), int(now.Sub(job.RequestedAt)/time.Minute))
+	}
+	return fmt.Sprintf("*%s* %s (%s) - %s", name, describeInputs(job), describeParams(job), status)
+}
+
+// homeRecentStatus describes how a cluster or job finished.
+func homeRecentStatus(job *Job) string {
+	description := job.OriginalMessage
+	if len(job.ClusterName) > 0 {
+		description = fmt.Sprintf("`%s`", job.ClusterName)
+	}
+	status := phaseDescription(job)
+	switch {
+	case len(job.StopReason) > 0:
+		status = job.StopReason
+	case job.Phase == JobPhaseFailed && len(job.Failure) > 0:
+		status = "failed: " + job.Failure
+	}
+	if len(job.URL) > 0 {
+		return fmt.Sprintf("%s - %s (<%s|logs>)", description, status, job.URL)
+	}
+	return fmt.Sprintf("%s - %s", description, status)
+}
+
+// homeResponder refreshes the App Home of users whose clusters or jobs changed.
+func (f *slackFrontend) homeResponder() UserCallbackFunc {
+	return func(user string) {
+		f.publishHome(user)
+	}
+}
+
+func (f *slackFrontend) publishHome(user string) {
+	view := homeView(f.manager.JobsForUser(user), f.manager.QuotaForUser(user), f.manager.CapacitySummary(), f.bot.extendEnabled, time.Now())
+	if _, err := f.client.PublishView(user, view, ""); err != nil {
+		klog.Infof("error: unable to publish the home of %s: %v", user, err)
+	}
+}
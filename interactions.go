@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/slack-go/slack"
+	"k8s.io/klog"
+)
+
+// serveInteractions listens for the interaction payloads Slack sends when a user clicks a button
+// on one of the bot's messages and routes them to the job manager.
+func (f *slackFrontend) serveInteractions() error {
+	mux := http.NewServeMux()
+	mux.Handle("/slack/interactive", f.interactionHandler())
+	klog.Infof("listening for slack interactions on %s", f.address)
+	return http.ListenAndServe(f.address, mux)
+}
+
+func (f *slackFrontend) interactionHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := verifiedBody(r, f.signingSecret)
+		if err != nil {
+			klog.Infof("rejected interaction: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var callback slack.InteractionCallback
+		if err := json.Unmarshal([]byte(values.Get("payload")), &callback); err != nil {
+			klog.Infof("unable to parse interaction payload: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// slack expects an answer within a few seconds, so the actions are handled asynchronously
+		w.WriteHeader(http.StatusOK)
+		go f.handleInteraction(callback)
+	}
+}
+
+// handleInteraction performs the actions of the buttons a user clicked on and handles the launch
+// form.
+func (f *slackFrontend) handleInteraction(callback slack.InteractionCallback) {
+	switch callback.Type {
+	case slack.InteractionTypeShortcut:
+		if callback.CallbackID == launchFormCallbackID {
+			f.openLaunchForm(callback.TriggerID)
+		}
+	case slack.InteractionTypeViewSubmission:
+		if callback.View.CallbackID == launchFormCallbackID {
+			f.submitLaunchForm(callback.User.ID, callback.View)
+		}
+	case slack.InteractionTypeBlockActions:
+		for _, action := range callback.ActionCallback.BlockActions {
+			switch action.ActionID {
+			case launchFormPlatform:
+				f.updateLaunchForm(callback.View, action.SelectedOption.Value)
+				continue
+			case actionLaunchForm:
+				f.openLaunchForm(callback.TriggerID)
+				continue
+			}
+			f.handleAction(callback.User.ID, callback.Channel.ID, action.ActionID, action.Value)
+		}
+	}
+}
+
+// verifiedBody reads the request body and checks that it was signed by Slack with the signing secret.
+func verifiedBody(r *http.Request, signingSecret string) ([]byte, error) {
+	verifier, err := slack.NewSecretsVerifier(r.Header, signingSecret)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(io.TeeReader(r.Body, &verifier))
+	if err != nil {
+		return nil, err
+	}
+	if err := verifier.Ensure(); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// handleAction performs the action a user clicked on and tells them the outcome. Actions on a
+// cluster are only accepted from the owner of the cluster. Actions clicked outside of a channel,
+// like on the App Home, are answered by direct message.
+func (f *slackFrontend) handleAction(user, channel, action, value string) {
+	manager := f.manager
+	reply := func(msg string) {
+		if len(channel) == 0 {
+			if _, _, err := f.PostMessage(user, "", msg); err != nil {
+				klog.Infof("error: unable to reply to interaction: %v", err)
+			}
+			return
+		}
+		if _, err := f.client.PostEphemeral(channel, user, slack.MsgOptionText(msg, false)); err != nil {
+			klog.Infof("error: unable to reply to interaction: %v", err)
+		}
+	}
+
+	var msg string
+	var err error
+	switch action {
+	case ActionLogs:
+		// the button opens the logs in the browser
+		return
+	case ActionApprove, ActionDeny:
+		msg, err = manager.ResolveApproval(channel, user, value, action == ActionApprove, "")
+	default:
+		name, clusterName := parseJobActionValue(value)
+		job, jobErr := manager.GetLaunchJob(user, clusterName)
+		if jobErr != nil || job.Name != name {
+			reply("this cluster is no longer running or belongs to someone else")
+			return
+		}
+		switch action {
+		case ActionDone:
+			msg, err = manager.TerminateJobForUser(user, clusterName)
+		case ActionExtend:
+			msg, err = manager.ExtendJobForUser(user, clusterName, time.Hour)
+		case ActionKeep:
+			msg, err = manager.KeepJobForUser(user, clusterName)
+		case ActionAuth:
+			if len(job.Credentials) == 0 {
+				reply("your cluster is still starting, I'll send you the credentials once it is ready")
+				return
+			}
+			job.RequestedChannel = channel
+			f.bot.sendCredentials(job)
+			return
+		default:
+			err = fmt.Errorf("unrecognized action %q", action)
+		}
+	}
+	if err != nil {
+		reply(err.Error())
+		return
+	}
+	reply(msg)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/slack-go/slack"
+	"k8s.io/klog"
+)
+
+// The launch form is a modal that builds the same request as the launch command, for users who do
+// not remember its options. The block and action IDs of each input are the same.
+const (
+	launchFormCallbackID = "launch"
+
+	launchFormRelease  = "launch_release"
+	launchFormVersion  = "launch_version"
+	launchFormPlatform = "launch_platform"
+	launchFormVariants = "launch_variants"
+	launchFormPRs      = "launch_prs"
+)
+
+// launchFormReleases are the releases to pick from, any other version or image can be typed in.
+var launchFormReleases = []string{"ci", "nightly"}
+
+// launchForm renders the form for a platform, offering only the variants of the platform. The
+// platform is kept in the private metadata of the view.
+func launchForm(platform string, variants []string) slack.ModalViewRequest {
+	text := func(value string) *slack.TextBlockObject {
+		return slack.NewTextBlockObject(slack.PlainTextType, value, false, false)
+	}
+	options := func(values []string) []*slack.OptionBlockObject {
+		var options []*slack.OptionBlockObject
+		for _, value := range values {
+			options = append(options, slack.NewOptionBlockObject(value, text(value), nil))
+		}
+		return options
+	}
+
+	release := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, text("Release"), launchFormRelease, options(launchFormReleases)...)
+	release.InitialOption = release.Options[0]
+	version := slack.NewInputBlock(launchFormVersion, text("Or a specific version or image"), slack.NewPlainTextInputBlockElement(text("4.10.0-0.nightly-2022-02-01-000000"), launchFormVersion))
+	version.Optional = true
+
+	platformSelect := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, text("Platform"), launchFormPlatform, options(supportedPlatforms)...)
+	for _, option := range platformSelect.Options {
+		if option.Value == platform {
+			platformSelect.InitialOption = option
+		}
+	}
+
+	blocks := []slack.Block{
+		slack.NewInputBlock(launchFormRelease, text("Release"), release),
+		version,
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, "*Platform*", false, false), nil, slack.NewAccessory(platformSelect), slack.SectionBlockOptionBlockID(launchFormPlatform)),
+	}
+	if len(variants) > 0 {
+		// the block ID changes with the platform so that variants checked for another platform are cleared
+		checkboxes := slack.NewInputBlock(launchFormVariants+"_"+platform, text("Variants"), slack.NewCheckboxGroupsBlockElement(launchFormVariants, options(variants)...))
+		checkboxes.Optional = true
+		blocks = append(blocks, checkboxes)
+	}
+	prs := slack.NewInputBlock(launchFormPRs, text("Pull requests"), slack.NewPlainTextInputBlockElement(text("openshift/installer#123, openshift/origin#456"), launchFormPRs))
+	prs.Hint = text("The pull requests are built into the release before the cluster is launched.")
+	prs.Optional = true
+	blocks = append(blocks, prs)
+
+	return slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		Title:           text("Launch a cluster"),
+		Submit:          text("Launch"),
+		Close:           text("Cancel"),
+		CallbackID:      launchFormCallbackID,
+		PrivateMetadata: platform,
+		Blocks:          slack.Blocks{BlockSet: blocks},
+	}
+}
+
+// launchFormArguments returns the arguments of the launch command that match the submitted form.
+func launchFormArguments(view slack.View) (string, string) {
+	platform := view.PrivateMetadata
+	if view.State == nil {
+		return "", platform
+	}
+	values := view.State.Values
+
+	imageOrVersion := values[launchFormRelease][launchFormRelease].SelectedOption.Value
+	if version := strings.TrimSpace(values[launchFormVersion][launchFormVersion].Value); len(version) > 0 {
+		imageOrVersion = version
+	}
+	inputs := []string{imageOrVersion}
+	inputs = append(inputs, strings.FieldsFunc(values[launchFormPRs][launchFormPRs].Value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n'
+	})...)
+
+	options := []string{platform}
+	for _, variant := range values[launchFormVariants+"_"+platform][launchFormVariants].SelectedOptions {
+		options = append(options, variant.Value)
+	}
+	return strings.Join(inputs, ","), strings.Join(options, ",")
+}
+
+// openLaunchForm shows the launch form to the user who triggered the interaction.
+func (f *slackFrontend) openLaunchForm(triggerID string) {
+	if _, err := f.client.OpenView(triggerID, launchForm("gcp", f.manager.VariantsForPlatform("gcp"))); err != nil {
+		klog.Infof("error: unable to open the launch form: %v", err)
+	}
+}
+
+// updateLaunchForm shows the variants of the platform the user picked.
+func (f *slackFrontend) updateLaunchForm(view slack.View, platform string) {
+	if _, err := f.client.UpdateView(launchForm(platform, f.manager.VariantsForPlatform(platform)), "", view.Hash, view.ID); err != nil {
+		klog.Infof("error: unable to update the launch form: %v", err)
+	}
+}
+
+// submitLaunchForm launches the cluster described by the submitted form. The outcome is sent to
+// the user by direct message, where the credentials will be delivered as well.
+func (f *slackFrontend) submitLaunchForm(user string, view slack.View) {
+	channel, err := f.PrivateChannel(user)
+	if err != nil {
+		klog.Warningf("Failed to open a direct message with %s: %v", user, err)
+		return
+	}
+	response := &channelResponse{frontend: f, channel: channel}
+
+	imageOrVersion, options := launchFormArguments(view)
+	req, err := newLaunchRequest(imageOrVersion, options, nil)
+	if err != nil {
+		response.Reply(err.Error())
+		return
+	}
+	req.OriginalMessage = fmt.Sprintf("launch %s %s", imageOrVersion, options)
+	req.User = user
+	req.Channel = channel
+	req.Priority = f.bot.priorityForUser(user)
+
+	msg, err := f.manager.LaunchJobForUser(req)
+	if err != nil {
+		response.Reply(err.Error())
+		return
+	}
+	response.Reply(msg)
+}
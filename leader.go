@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog"
+)
+
+const (
+	// leaseDuration is how long a standby waits for a leader that stopped renewing its lease
+	leaseDuration      = 15 * time.Second
+	leaseRenewDeadline = 10 * time.Second
+	leaseRetryPeriod   = 2 * time.Second
+)
+
+// runAsLeader runs the bot once this replica holds the lease, so only one of several replicas
+// syncs jobs, starts workers and sends notifications while the others stand by to take over.
+// Cancelling the context releases the lease so a standby takes over right away. Once the lease is
+// lost the process exits, since the manager cannot be stopped halfway through its work, and the
+// replica comes back as a standby.
+func runAsLeader(ctx context.Context, client clientset.Interface, namespace, name string, run func() error) error {
+	identity, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("unable to determine the identity of this replica: %v", err)
+	}
+	lock, err := resourcelock.New(resourcelock.LeasesResourceLock, namespace, name, client.CoreV1(), client.CoordinationV1(), resourcelock.ResourceLockConfig{Identity: identity})
+	if err != nil {
+		return fmt.Errorf("unable to create the lease lock: %v", err)
+	}
+
+	errs := make(chan error, 1)
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		Name:            name,
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   leaseRenewDeadline,
+		RetryPeriod:     leaseRetryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) {
+				klog.Infof("Replica %s is the leader, starting the bot", identity)
+				errs <- run()
+			},
+			OnStoppedLeading: func() {
+				klog.Infof("Replica %s is no longer the leader, exiting", identity)
+				os.Exit(0)
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					klog.Infof("Replica %s is the leader, standing by", leader)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to set up leader election: %v", err)
+	}
+
+	go elector.Run(ctx)
+	return <-errs
+}
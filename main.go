@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -9,6 +10,7 @@ import (
 	"os"
 	"path"
 	"regexp"
+	"strings"
 	"sync"
 	"time"
 
@@ -44,6 +46,28 @@ type options struct {
 	ReleaseClusterKubeconfig        string
 	ConfigResolver                  string
 	WorkflowConfigPath              string
+	CapacityConfigPath              string
+	PriorityConfigPath              string
+	UserQuota                       time.Duration
+	UserQuotaWindow                 time.Duration
+	MaxClusterLifetime              time.Duration
+	MaxApprovedLifetime             time.Duration
+	EnableExtend                    bool
+	ApprovalChannel                 string
+	ExpiryWarnings                  []time.Duration
+	IdleCheckIn                     time.Duration
+	IdleTimeout                     time.Duration
+	InteractionsAddress             string
+	SlackMode                       string
+	Chat                            string
+	MattermostURL                   string
+	CredentialsAddress              string
+	CredentialsURL                  string
+	CredentialsCertFile             string
+	CredentialsKeyFile              string
+	StateFile                       string
+	StateConfigMap                  string
+	LeaderElectionLease             string
 }
 
 func main() {
@@ -63,6 +87,12 @@ func run() error {
 		GithubEndpoint:                  "https://api.github.com",
 		ConfigResolver:                  "http://config.ci.openshift.org/config",
 		BuildClusterKubeconfigsLocation: "/var/build-cluster-kubeconfigs",
+		MaxClusterLifetime:              12 * time.Hour,
+		MaxApprovedLifetime:             48 * time.Hour,
+		ExpiryWarnings:                  []time.Duration{30 * time.Minute, 10 * time.Minute},
+		IdleCheckIn:                     90 * time.Minute,
+		IdleTimeout:                     30 * time.Minute,
+		UserQuotaWindow:                 7 * 24 * time.Hour,
 	}
 	var ignored string
 	pflag.StringVar(&opt.ConfigResolver, "config-resolver", opt.ConfigResolver, "A URL pointing to a config resolver for retrieving ci-operator config. You may pass a location on disk with file://<abs_path_to_ci_operator_config>")
@@ -72,6 +102,28 @@ func run() error {
 	pflag.StringVar(&opt.BuildClusterKubeconfigsLocation, "build-cluster-kubeconfigs-location", opt.BuildClusterKubeconfigsLocation, "Path to the location of the Kubeconfigs for the various buildclusters. Default is \"/var/build-cluster-kubeconfigs\".")
 	pflag.StringVar(&opt.ReleaseClusterKubeconfig, "release-cluster-kubeconfig", "", "Kubeconfig to use for cluster housing the release imagestreams. Defaults to normal kubeconfig if unset.")
 	pflag.StringVar(&opt.WorkflowConfigPath, "workflow-config-path", "", "Path to config file used for workflow commands")
+	pflag.StringVar(&opt.PriorityConfigPath, "priority-config-path", "", "Path to config file listing the users and groups whose launches take priority")
+	pflag.StringVar(&opt.CapacityConfigPath, "capacity-config-path", "", "Path to config file defining how many clusters may run on each platform")
+	pflag.DurationVar(&opt.MaxClusterLifetime, "max-cluster-lifetime", opt.MaxClusterLifetime, "The longest a cluster may run for, including any extensions requested by its owner.")
+	pflag.DurationVar(&opt.MaxApprovedLifetime, "max-approved-lifetime", opt.MaxApprovedLifetime, "The longest lifetime a user may request for a cluster with approval.")
+	pflag.BoolVar(&opt.EnableExtend, "enable-extend", false, "Let owners extend their running clusters with the extend command. Clusters are then launched for their maximum lifetime and shut down by the bot when they expire, see docs/FAQ.md.")
+	pflag.StringVar(&opt.ApprovalChannel, "approval-channel", "", "The ID of the channel where requests for long-lived clusters are approved. Long-lived clusters are disabled if unset.")
+	pflag.DurationVar(&opt.IdleCheckIn, "idle-check-in", opt.IdleCheckIn, "How long after launch owners are asked whether they still use their cluster. Set to 0 to disable check-ins.")
+	pflag.DurationVar(&opt.IdleTimeout, "idle-timeout", opt.IdleTimeout, "How long owners have to answer the idle check-in before their cluster is shut down.")
+	pflag.DurationVar(&opt.UserQuota, "user-quota", opt.UserQuota, "The cluster time a single user may consume within the quota window, e.g. 40h. Set to 0 for no limit.")
+	pflag.DurationVar(&opt.UserQuotaWindow, "user-quota-window", opt.UserQuotaWindow, "The rolling window over which cluster usage is counted against the user quota.")
+	pflag.StringVar(&opt.InteractionsAddress, "interactions-address", "", "Address to listen on for Slack interactions such as button clicks, e.g. :8080. Requires SLACK_SIGNING_SECRET to be set.")
+	pflag.StringVar(&opt.Chat, "chat", "slack", "The chat service to connect to: slack or mattermost. BOT_TOKEN holds the token of the bot account on either.")
+	pflag.StringVar(&opt.MattermostURL, "mattermost-url", "", "The URL of the Mattermost server to connect to, e.g. https://chat.example.com.")
+	pflag.StringVar(&opt.SlackMode, "slack-mode", "rtm", "How to connect to Slack: rtm, socket (requires SLACK_APP_TOKEN) or events (receives events, slash commands and interactions on --interactions-address).")
+	pflag.StringVar(&opt.CredentialsAddress, "credentials-address", "", "Address to serve one-time credential links on, e.g. :8443. If set, credentials are sent as links instead of being uploaded to Slack.")
+	pflag.StringVar(&opt.CredentialsURL, "credentials-url", "", "The external HTTPS URL that --credentials-address is reachable at.")
+	pflag.StringVar(&opt.CredentialsCertFile, "credentials-cert-file", "", "Certificate to serve credential links with. If unset, links are served over HTTP and TLS must be terminated in front of the bot.")
+	pflag.StringVar(&opt.CredentialsKeyFile, "credentials-key-file", "", "Private key of --credentials-cert-file.")
+	pflag.StringVar(&opt.StateFile, "state-file", "", "Path to a file that requests, history and user settings are saved in so they survive a restart.")
+	pflag.StringVar(&opt.StateConfigMap, "state-configmap", "", "A config map, as namespace/name, on the prow job cluster that requests, history and user settings are saved in. Takes the place of --state-file.")
+	pflag.StringVar(&opt.LeaderElectionLease, "leader-election-lease", "", "A lease, as namespace/name, on the prow job cluster that replicas of the bot elect a leader with. Only the leader runs, the other replicas stand by to take over. Requires --state-configmap.")
+	pflag.DurationSliceVar(&opt.ExpiryWarnings, "expiry-warnings", opt.ExpiryWarnings, "How long before a cluster expires its owner is warned. Set to 0 to disable warnings.")
 	opt.prowconfig.AddFlags(emptyFlags)
 	pflag.CommandLine.AddGoFlagSet(emptyFlags)
 	pflag.Parse()
@@ -82,7 +134,9 @@ func run() error {
 		return fmt.Errorf("unable to load build cluster configurations: %v", err)
 	}
 
-	if err := setupKubeconfigWatches(buildClusterClientConfigs); err != nil {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := setupKubeconfigWatches(buildClusterClientConfigs, len(opt.LeaderElectionLease) > 0, cancel); err != nil {
 		klog.Warningf("failed to set up kubeconfig watches: %v", err)
 	}
 
@@ -121,19 +175,115 @@ func run() error {
 
 	workflows := WorkflowConfig{}
 	go manageWorkflowConfig(opt.WorkflowConfigPath, &workflows)
+	capacity := CapacityConfig{}
+	go manageCapacityConfig(opt.CapacityConfigPath, &capacity)
+	priorities := PriorityConfig{}
+	go managePriorityConfig(opt.PriorityConfigPath, &priorities)
 
-	manager := NewJobManager(configAgent, resolver, prowClient, imageClient, buildClusterClientConfigs, opt.GithubEndpoint, opt.ForcePROwner, &workflows)
-	if err := manager.Start(); err != nil {
-		return fmt.Errorf("unable to load initial configuration: %v", err)
+	coreClient, err := clientset.NewForConfig(prowJobKubeconfig)
+	if err != nil {
+		return fmt.Errorf("unable to create core client: %v", err)
 	}
 
-	bot := NewBot(botToken, &workflows)
-	for {
-		if err := bot.Start(manager); err != nil && !isRetriable(err) {
-			return err
+	// every replica would read its own state file, so the leader that takes over would lose the
+	// state of the previous one
+	if len(opt.LeaderElectionLease) > 0 && len(opt.StateConfigMap) == 0 {
+		return fmt.Errorf("--leader-election-lease requires --state-configmap so replicas share their state")
+	}
+
+	var store StateStore
+	switch {
+	case len(opt.StateConfigMap) > 0:
+		parts := strings.Split(opt.StateConfigMap, "/")
+		if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return fmt.Errorf("--state-configmap must be of the form namespace/name")
+		}
+		store = NewConfigMapStore(coreClient, parts[0], parts[1])
+	case len(opt.StateFile) > 0:
+		store = NewFileStore(opt.StateFile)
+	default:
+		klog.Warningf("Neither --state-file nor --state-configmap is set, requests that are not yet running and history are lost on restart")
+	}
+
+	manager := NewJobManager(configAgent, resolver, prowClient, imageClient, buildClusterClientConfigs, opt.GithubEndpoint, opt.ForcePROwner, &workflows, opt.MaxClusterLifetime, opt.MaxApprovedLifetime, opt.EnableExtend, opt.ApprovalChannel, opt.ExpiryWarnings, opt.IdleCheckIn, opt.IdleTimeout, &capacity, &priorities, opt.UserQuota, opt.UserQuotaWindow, store)
+
+	var credentials *credentialStore
+	if len(opt.CredentialsAddress) > 0 {
+		if !strings.HasPrefix(opt.CredentialsURL, "https://") {
+			return fmt.Errorf("--credentials-url must be an https:// URL to serve credential links")
+		}
+		if (len(opt.CredentialsCertFile) > 0) != (len(opt.CredentialsKeyFile) > 0) {
+			return fmt.Errorf("--credentials-cert-file and --credentials-key-file must be set together")
 		}
-		time.Sleep(5 * time.Second)
+		credentials = newCredentialStore(opt.CredentialsURL)
 	}
+
+	var startBot func() error
+	switch opt.Chat {
+	case "slack":
+		signingSecret := os.Getenv("SLACK_SIGNING_SECRET")
+		appToken := os.Getenv("SLACK_APP_TOKEN")
+		switch opt.SlackMode {
+		case "socket":
+			if len(appToken) == 0 {
+				return fmt.Errorf("the environment variable SLACK_APP_TOKEN must be set to use socket mode")
+			}
+		case "events":
+			if len(opt.InteractionsAddress) == 0 || len(signingSecret) == 0 {
+				return fmt.Errorf("--interactions-address and the environment variable SLACK_SIGNING_SECRET must be set to receive events")
+			}
+		case "rtm":
+			if len(opt.InteractionsAddress) > 0 && len(signingSecret) == 0 {
+				return fmt.Errorf("the environment variable SLACK_SIGNING_SECRET must be set to receive interactions")
+			}
+		default:
+			return fmt.Errorf("--slack-mode must be one of rtm, socket or events")
+		}
+		bot := NewBot(NewSlackFrontend(botToken, opt.SlackMode, appToken, opt.InteractionsAddress, signingSecret), &workflows, &priorities, credentials, opt.EnableExtend)
+		startBot = func() error {
+			if opt.SlackMode != "rtm" {
+				return bot.Start(manager)
+			}
+			for {
+				if err := bot.Start(manager); err != nil && !isRetriable(err) {
+					return err
+				}
+				time.Sleep(5 * time.Second)
+			}
+		}
+	case "mattermost":
+		if len(opt.MattermostURL) == 0 {
+			return fmt.Errorf("--mattermost-url must be set to connect to mattermost")
+		}
+		bot := NewBot(NewMattermostFrontend(opt.MattermostURL, botToken), &workflows, &priorities, credentials, opt.EnableExtend)
+		startBot = func() error {
+			return bot.Start(manager)
+		}
+	default:
+		return fmt.Errorf("--chat must be one of slack or mattermost")
+	}
+
+	// standby replicas neither connect to the chat service nor listen for interactions and
+	// credential links, so those only reach the leader
+	start := func() error {
+		if err := manager.Start(); err != nil {
+			return fmt.Errorf("unable to load initial configuration: %v", err)
+		}
+		if credentials != nil {
+			go func() {
+				klog.Fatalf("unable to serve credential links: %v", credentials.Serve(opt.CredentialsAddress, opt.CredentialsCertFile, opt.CredentialsKeyFile))
+			}()
+		}
+		return startBot()
+	}
+	if len(opt.LeaderElectionLease) == 0 {
+		return start()
+	}
+	parts := strings.Split(opt.LeaderElectionLease, "/")
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return fmt.Errorf("--leader-election-lease must be of the form namespace/name")
+	}
+	return runAsLeader(ctx, coreClient, parts[0], parts[1], start)
 }
 
 type BuildClusterClientConfig struct {
@@ -194,7 +344,10 @@ func readBuildClusterKubeConfigs(location string) (BuildClusterClientConfigMap,
 	return clusterMap, nil
 }
 
-func setupKubeconfigWatches(clusters BuildClusterClientConfigMap) error {
+// setupKubeconfigWatches exits when a kubeconfig changes so the kubelet restarts the bot with the new
+// kubeconfigs. A replica that takes part in leader election stops instead, which releases the lease
+// before it exits.
+func setupKubeconfigWatches(clusters BuildClusterClientConfigMap, leaderElection bool, stop func()) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return fmt.Errorf("failed to set up watcher: %w", err)
@@ -215,6 +368,10 @@ func setupKubeconfigWatches(clusters BuildClusterClientConfigMap) error {
 				continue
 			}
 			klog.Infof("event: %s, kubeconfig changed, exiting to make the kubelet restart us so we can pick them up", e.String())
+			if leaderElection {
+				stop()
+				continue
+			}
 			os.Exit(0)
 		}
 	}()
@@ -233,6 +390,124 @@ type WorkflowConfigItem struct {
 	Platform     string                                     `yaml:"platform"`
 }
 
+// CapacityConfig limits how many clusters may run at once on each platform, as each platform is
+// backed by its own cloud account and quota. For example:
+//
+//	platforms:
+//	  aws:
+//	    limit: 20
+//	    architectures:
+//	      arm64: 4
+//	  metal:
+//	    limit: 4
+type CapacityConfig struct {
+	Platforms map[string]PlatformCapacity `yaml:"platforms"`
+	mutex     sync.RWMutex                `yaml:"-"` // this field just allows us to update the above values without races
+}
+
+type PlatformCapacity struct {
+	// Limit is the number of clusters that may run on the platform at once. Zero means no limit.
+	Limit int `yaml:"limit"`
+	// Architectures optionally limits the number of clusters of an architecture on the platform.
+	Architectures map[string]int `yaml:"architectures,omitempty"`
+}
+
+// Limits returns the platform wide and architecture specific limits for a platform. Zero means
+// there is no limit.
+func (c *CapacityConfig) Limits(platform, architecture string) (int, int) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	capacity, ok := c.Platforms[platform]
+	if !ok {
+		return 0, 0
+	}
+	return capacity.Limit, capacity.Architectures[architecture]
+}
+
+// Snapshot returns a copy of the current limits.
+func (c *CapacityConfig) Snapshot() map[string]PlatformCapacity {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	platforms := make(map[string]PlatformCapacity, len(c.Platforms))
+	for name, capacity := range c.Platforms {
+		platforms[name] = capacity
+	}
+	return platforms
+}
+
+func manageCapacityConfig(path string, capacity *CapacityConfig) {
+	if len(path) == 0 {
+		return
+	}
+	for {
+		// Unlike workflows, a broken config keeps the last known limits in place so that a bad
+		// change does not allow every platform to be oversubscribed.
+		var config CapacityConfig
+		rawConfig, err := ioutil.ReadFile(path)
+		if err != nil {
+			klog.Errorf("Failed to load capacity config file at %s: %v", path, err)
+		} else if err := yaml.Unmarshal(rawConfig, &config); err != nil {
+			klog.Errorf("Failed to unmarshal capacity config: %v", err)
+		} else {
+			capacity.mutex.Lock()
+			capacity.Platforms = config.Platforms
+			capacity.mutex.Unlock()
+		}
+		time.Sleep(2 * time.Minute)
+	}
+}
+
+// PriorityConfig lists the users whose cluster requests are served before everyone else, for
+// example release engineers during a release. Users may be listed by Slack user ID or by the ID of
+// a Slack user group they belong to.
+type PriorityConfig struct {
+	Users  []string `yaml:"users,omitempty"`
+	Groups []string `yaml:"groups,omitempty"`
+	// Preempt allows a priority request to shut down the oldest normal priority cluster when no
+	// capacity is available, as long as that cluster has been running for the grace period.
+	Preempt     bool          `yaml:"preempt,omitempty"`
+	GracePeriod time.Duration `yaml:"gracePeriod,omitempty"`
+	mutex       sync.RWMutex  `yaml:"-"` // this field just allows us to update the above values without races
+}
+
+// Members returns the users and user groups with priority.
+func (c *PriorityConfig) Members() ([]string, []string) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.Users, c.Groups
+}
+
+// Preemption returns whether priority requests may preempt other clusters and how long those
+// clusters are guaranteed to run before they can be preempted.
+func (c *PriorityConfig) Preemption() (bool, time.Duration) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.Preempt, c.GracePeriod
+}
+
+func managePriorityConfig(path string, priorities *PriorityConfig) {
+	if len(path) == 0 {
+		return
+	}
+	for {
+		var config PriorityConfig
+		rawConfig, err := ioutil.ReadFile(path)
+		if err != nil {
+			klog.Errorf("Failed to load priority config file at %s: %v", path, err)
+		} else if err := yaml.Unmarshal(rawConfig, &config); err != nil {
+			klog.Errorf("Failed to unmarshal priority config: %v", err)
+		} else {
+			priorities.mutex.Lock()
+			priorities.Users = config.Users
+			priorities.Groups = config.Groups
+			priorities.Preempt = config.Preempt
+			priorities.GracePeriod = config.GracePeriod
+			priorities.mutex.Unlock()
+		}
+		time.Sleep(2 * time.Minute)
+	}
+}
+
 func manageWorkflowConfig(path string, workflows *WorkflowConfig) {
 	for {
 		// To prevent the ci-chat-bot from crashlooping due to a bad config change,
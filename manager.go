@@ -32,6 +32,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
 	prowapiv1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
 )
 
@@ -40,6 +41,9 @@ const (
 	// a single user from consuming the infrastructure account.
 	maxJobsPerUser = 23
 
+	// maxClustersPerUser limits the number of simultaneous named clusters a user can launch.
+	maxClustersPerUser = 3
+
 	// maxTotalClusters limits the number of simultaneous clusters across all users to
 	// prevent saturating the infrastructure account.
 	maxTotalClusters = 48
@@ -66,10 +70,27 @@ type JobRequest struct {
 	// WorkflowName is a field used to store the name of the workflow to run for workflow commands
 	WorkflowName string
 
-	Channel     string
+	Channel string
+	// Thread is the thread in the channel the request was made in, if it was not a direct message.
+	Thread      string
 	RequestedAt time.Time
 	Name        string
 
+	// ClusterName is an optional name chosen by the user to tell apart multiple clusters they
+	// have launched. The empty name is the user's default cluster.
+	ClusterName string
+
+	// Priority is set by the bot for users on the priority list.
+	Priority Priority
+
+	// Reservation is the ID of the reservation the cluster is launched for, if any.
+	Reservation string
+	// Lifetime overrides how long the cluster runs for if set. Lifetimes longer than the default
+	// must be approved.
+	Lifetime time.Duration
+	// ApprovedBy is the user who approved the lifetime of the cluster.
+	ApprovedBy string
+
 	JobName   string
 	JobParams map[string]string
 
@@ -78,6 +99,16 @@ type JobRequest struct {
 
 type JobType string
 
+// Priority determines the order in which cluster requests are served when no capacity is available.
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	// PriorityHigh requests are placed ahead of normal requests on the waitlist and may preempt
+	// normal clusters if configured.
+	PriorityHigh
+)
+
 const (
 	JobTypeBuild = "build"
 	// TODO: remove this const. It seems out of date and replaced by launch everywhere except for in JobRequest.JobType. Gets changed to "launch" for job.Mode
@@ -92,19 +123,114 @@ const (
 // clusters.
 type JobManager interface {
 	SetNotifier(JobCallbackFunc)
+	SetMessageNotifier(MessageCallbackFunc)
+	SetUserNotifier(UserCallbackFunc)
+	SetProgressNotifier(ProgressCallbackFunc)
 
 	LaunchJobForUser(req *JobRequest) (string, error)
-	SyncJobForUser(user string) (string, error)
-	TerminateJobForUser(user string) (string, error)
-	GetLaunchJob(user string) (*Job, error)
+	SyncJobForUser(user, name string) (string, error)
+	TerminateJobForUser(user, name string) (string, error)
+	ExtendJobForUser(user, name string, duration time.Duration) (string, error)
+	QuotaForUser(user string) string
+	HistoryForUser(user string) string
+	SettingsForUser(user string) UserSettings
+	UpdateSettingsForUser(user string, settings UserSettings)
+	KeepJobForUser(user, name string) (string, error)
+
+	ReserveForUser(reservation *Reservation) (string, error)
+	CancelReservationForUser(user, id string) (string, error)
+	ListReservations() string
+
+	ResolveApproval(channel, approver, id string, approved bool, reason string) (string, error)
+	GetLaunchJob(user, name string) (*Job, error)
 	LookupInputs(inputs []string) (string, error)
 	ListJobs(users ...string) string
+	JobsForUser(user string) []Job
+	JobForLink(link string) (*Job, error)
+	CapacitySummary() string
+	VariantsForPlatform(platform string) []string
 }
 
 // JobCallbackFunc is invoked when the job changes state in a significant
 // way.
 type JobCallbackFunc func(Job)
 
+// UserCallbackFunc is invoked when the clusters or jobs of a user change.
+type UserCallbackFunc func(user string)
+
+// ProgressCallbackFunc is invoked when the launch of a cluster reaches a new step,
+// fails or is stopped, with the usual time a launch takes. It returns the channel and ID
+// of the message the progress is shown in, or empty strings if it could not be posted.
+type ProgressCallbackFunc func(job Job, estimate time.Duration) (channel, id string)
+
+// LaunchStep is the last step a cluster launch has completed.
+type LaunchStep int
+
+const (
+	LaunchStepCreated LaunchStep = iota
+	LaunchStepURLAssigned
+	LaunchStepScheduled
+	LaunchStepInstalling
+	LaunchStepKubeconfig
+	LaunchStepReachable
+	LaunchStepReady
+)
+
+var launchStepNames = [...]string{
+	"Prow job created",
+	"Logs available",
+	"Pod scheduled",
+	"Installing the cluster",
+	"Kubeconfig available",
+	"API reachable",
+	"Ready",
+}
+
+func (s LaunchStep) String() string {
+	return launchStepNames[s]
+}
+
+// MessageCallbackFunc is invoked to deliver an informational message to a user
+// on the channel they made their request from, in the thread of the request if
+// it was made in a channel. If the channel is a user ID the message is delivered
+// as a direct message to that user. The message text always describes the
+// commands that match the offered actions.
+type MessageCallbackFunc func(channel, thread, message string, actions ...MessageAction)
+
+// Actions that can be offered alongside a message.
+const (
+	ActionDone    = "done"
+	ActionAuth    = "auth"
+	ActionExtend  = "extend"
+	ActionKeep    = "keep"
+	ActionLogs    = "logs"
+	ActionApprove = "approve"
+	ActionDeny    = "deny"
+)
+
+// MessageAction is an action the recipient of a message can take in response, shown as a button
+// by chat clients that support it.
+type MessageAction struct {
+	ID    string
+	Label string
+	// Value identifies what the action applies to, see jobActionValue. For ActionLogs it is the URL.
+	Value string
+}
+
+// jobActionValue identifies the cluster an action applies to.
+func jobActionValue(job *Job) string {
+	return fmt.Sprintf("%s/%s", job.Name, job.ClusterName)
+}
+
+// parseJobActionValue returns the job name and cluster name from the value of an action.
+func parseJobActionValue(value string) (string, string) {
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
 // JobInput defines the input to a job. Different modes need different inputs.
 type JobInput struct {
 	Image   string
@@ -132,17 +258,42 @@ type Job struct {
 
 	Inputs []JobInput
 
+	// Phase is where the job is in its lifecycle
+	Phase JobPhase
+
 	Credentials     string
 	PasswordSnippet string
 	Failure         string
 
 	RequestedBy      string
 	RequestedChannel string
+	// RequestedThread is set if the job was requested in a channel, notifications are posted to it
+	RequestedThread string
+	ClusterName     string
+	Priority        Priority
+	Reservation     string
 
-	RequestedAt   time.Time
-	ExpiresAt     time.Time
-	StartDuration time.Duration
-	Complete      bool
+	RequestedAt time.Time
+	ExpiresAt   time.Time
+	// Progress is the last step the launch of the cluster has completed
+	Progress LaunchStep
+	// ProgressAt is when the launch completed each step, zero for steps it has not reached
+	ProgressAt [len(launchStepNames)]time.Time
+	// ProgressMessage is the message the progress of the launch is shown in, as channel/ID, so it
+	// can be edited by a process that picks up the launch after a restart
+	ProgressMessage string
+	StartDuration   time.Duration
+	// Lifetime is how long the cluster runs for before any extension, or zero for the default
+	Lifetime   time.Duration
+	ApprovedBy string
+	// ExpiryWarning is the smallest warning threshold the owner has already been notified about
+	ExpiryWarning time.Duration
+	// CheckInSentAt is when the owner was asked whether they still use the cluster
+	CheckInSentAt time.Time
+	// Kept is set once the owner has confirmed they still use the cluster
+	Kept bool
+	// StopReason explains why the bot shut the cluster down early
+	StopReason string
 
 	Architecture string
 	BuildCluster string
@@ -152,20 +303,67 @@ type Job struct {
 	WorkflowName string
 }
 
+// IsComplete reports whether the job has nothing left to wait for.
 func (j Job) IsComplete() bool {
-	return j.Complete || len(j.Credentials) > 0 || (len(j.State) > 0 && j.State != prowapiv1.PendingState)
+	return j.Phase == JobPhaseReady || j.Phase.Stopped()
+}
+
+// clusterUsage is the time a cluster was running, used to calculate how much of their quota a user
+// has consumed.
+type clusterUsage struct {
+	user  string
+	start time.Time
+	// end is zero while the cluster is running
+	end time.Time
 }
 
 type jobManager struct {
 	lock                 sync.Mutex
 	requests             map[string]*JobRequest
 	jobs                 map[string]*Job
+	waitlist             []waitlistEntry
 	started              time.Time
 	recentStartEstimates []time.Duration
 
 	clusterPrefix string
 	maxClusters   int
 	maxAge        time.Duration
+	// maxLifetime caps how long a cluster may run, including any extensions
+	maxLifetime time.Duration
+	// maxApprovedLifetime caps the lifetime that may be requested with approval
+	maxApprovedLifetime time.Duration
+	// extendEnabled allows owners to extend running clusters. Clusters are then launched for their
+	// maximum lifetime and stopped by the bot when they expire.
+	extendEnabled bool
+	// approvalChannel is where requests for long-lived clusters are sent for approval
+	approvalChannel string
+	approvals       map[string]*JobRequest
+	approvalCount   int
+	// expiryWarnings are the times before expiry at which owners are warned
+	expiryWarnings []time.Duration
+	// idleCheckIn is how long after launch owners are asked whether they still use their cluster,
+	// and idleTimeout how long they have to answer before it is shut down. Zero disables check-ins.
+	idleCheckIn time.Duration
+	idleTimeout time.Duration
+	capacity    *CapacityConfig
+	priority    *PriorityConfig
+	// quota is the number of cluster-hours a user may consume within quotaWindow, or zero
+	quota       time.Duration
+	quotaWindow time.Duration
+	// usage is the running time of every cluster seen by the last sync, by prow job name
+	usage map[string]clusterUsage
+	// history holds the jobs that completed within the quota window, or at least a month
+	history  []JobRecord
+	settings map[string]UserSettings
+
+	// store saves the state that cannot be rebuilt from prow jobs, savedState is what it last saved
+	store      StateStore
+	savedState []byte
+
+	reservations     []*Reservation
+	reservationCount int
+	// launchFn launches the clusters of a reservation once it starts
+	launchFn func(req *JobRequest) (string, error)
 
 	prowConfigLoader prow.ProwConfigLoader
 	prowClient       dynamic.NamespaceableResourceInterface
@@ -182,10 +380,34 @@ type jobManager struct {
 		running map[string]struct{}
 	}
 
+	// prowJobs watches the prow jobs launched by the bot, a sync is requested whenever they change
+	prowJobs      cache.SharedIndexInformer
+	syncRequested chan struct{}
+	// podInformers watch the prow job pods on each build cluster
+	podInformers struct {
+		lock      sync.Mutex
+		informers map[string]cache.SharedIndexInformer
+	}
+	// changes wakes up the workers waiting for a job when its prow job or pods change
+	changes struct {
+		lock    sync.Mutex
+		waiting map[string]chan struct{}
+	}
+
 	notifierFn     JobCallbackFunc
+	userFn         UserCallbackFunc
+	messageFn      MessageCallbackFunc
+	progressFn     ProgressCallbackFunc
 	workflowConfig *WorkflowConfig
 }
 
+// waitlistEntry is a launch request that is waiting for a cluster slot to become
+// available. The job has already been resolved and will be renamed when started.
+type waitlistEntry struct {
+	request *JobRequest
+	job     *Job
+}
+
 // NewJobManager creates a manager that will track the requests made by a user to create clusters
 // and reflect that state into ProwJobs that launch clusters. It attempts to recreate state on startup
 // by querying prow, but does not guarantee that some notifications to users may not be sent or may be
@@ -198,14 +420,38 @@ func NewJobManager(
 	buildClusterClientConfigMap BuildClusterClientConfigMap,
 	githubURL, forcePROwner string,
 	workflowConfig *WorkflowConfig,
+	maxLifetime, maxApprovedLifetime time.Duration,
+	extendEnabled bool,
+	approvalChannel string,
+	expiryWarnings []time.Duration,
+	idleCheckIn, idleTimeout time.Duration,
+	capacity *CapacityConfig,
+	priority *PriorityConfig,
+	quota, quotaWindow time.Duration,
+	store StateStore,
 ) *jobManager {
 	m := &jobManager{
-		requests:      make(map[string]*JobRequest),
-		jobs:          make(map[string]*Job),
-		clusterPrefix: "chat-bot-",
-		maxClusters:   maxTotalClusters,
-		maxAge:        3 * time.Hour,
-		githubURL:     githubURL,
+		requests:            make(map[string]*JobRequest),
+		jobs:                make(map[string]*Job),
+		clusterPrefix:       "chat-bot-",
+		maxClusters:         maxTotalClusters,
+		maxAge:              3 * time.Hour,
+		maxLifetime:         maxLifetime,
+		maxApprovedLifetime: maxApprovedLifetime,
+		extendEnabled:       extendEnabled,
+		approvalChannel:     approvalChannel,
+		approvals:           make(map[string]*JobRequest),
+		expiryWarnings:      expiryWarnings,
+		idleCheckIn:         idleCheckIn,
+		idleTimeout:         idleTimeout,
+		capacity:            capacity,
+		priority:            priority,
+		quota:               quota,
+		quotaWindow:         quotaWindow,
+		usage:               make(map[string]clusterUsage),
+		settings:            make(map[string]UserSettings),
+		store:               store,
+		githubURL:           githubURL,
 
 		prowConfigLoader: prowConfigLoader,
 		prowClient:       prowClient,
@@ -217,18 +463,36 @@ func NewJobManager(
 		configResolver: configResolver,
 		workflowConfig: workflowConfig,
 	}
+	m.launchFn = m.LaunchJobForUser
 	m.muJob.running = make(map[string]struct{})
+	m.prowJobs = newProwJobInformer(prowClient, m.prowNamespace)
+	m.syncRequested = make(chan struct{}, 1)
+	m.podInformers.informers = make(map[string]cache.SharedIndexInformer)
+	m.changes.waiting = make(map[string]chan struct{})
 	return m
 }
 
 func (m *jobManager) Start() error {
-	go wait.Forever(func() {
-		if err := m.sync(); err != nil {
-			klog.Infof("error during sync: %v", err)
-			return
-		}
-		time.Sleep(5 * time.Minute)
-	}, time.Minute)
+	if err := m.restoreState(); err != nil {
+		return fmt.Errorf("unable to restore state: %v", err)
+	}
+	if m.store != nil {
+		go wait.Forever(m.saveState, 10*time.Second)
+	}
+	m.lock.Lock()
+	m.started = time.Now()
+	m.lock.Unlock()
+	m.startWatching()
+	if len(m.expiryWarnings) > 0 {
+		go wait.Forever(m.warnExpiringJobs, time.Minute)
+	}
+	if m.idleCheckIn > 0 && m.idleTimeout > 0 {
+		go wait.Forever(m.checkInIdleJobs, time.Minute)
+	}
+	if m.extendEnabled {
+		go wait.Forever(m.stopExpiredJobs, time.Minute)
+	}
+	go wait.Forever(m.startReservations, time.Minute)
 	return nil
 }
 
@@ -271,17 +535,20 @@ func paramsToString(params map[string]string) string {
 	return strings.Join(pairs, ",")
 }
 
-func (m *jobManager) sync() error {
-	u, err := m.prowClient.Namespace(m.prowNamespace).List(context.TODO(), metav1.ListOptions{
-		LabelSelector: labels.SelectorFromSet(labels.Set{
-			"ci-chat-bot.openshift.io/launch": "true",
-		}).String(),
-	})
+// jobFromProwJob restores the fields of a job that are recorded on its prow job. Jobs without
+// inputs were not created by the bot and are ignored, as are jobs with unreadable annotations.
+func jobFromProwJob(job *prowapiv1.ProwJob) (*Job, bool) {
+	j, err := decodeJobAnnotations(job)
 	if err != nil {
-		return err
+		klog.Infof("Ignoring job %s: %v", job.Name, err)
+		return nil, false
 	}
-	list := &prowapiv1.ProwJobList{}
-	if err := prow.UnstructuredToObject(u, list); err != nil {
+	return j, true
+}
+
+func (m *jobManager) sync() error {
+	prowJobs, err := m.listProwJobs()
+	if err != nil {
 		return err
 	}
 
@@ -293,141 +560,92 @@ func (m *jobManager) sync() error {
 		m.started = now
 	}
 
-	for _, job := range list.Items {
-		previous := m.jobs[job.Name]
-
-		value := job.Annotations["ci-chat-bot.openshift.io/jobInputs"]
-		var inputs []JobInput
-		if len(value) > 0 {
-			if err := json.Unmarshal([]byte(value), &inputs); err != nil {
-				klog.Warningf("Could not deserialize job input annotation from build %s: %v", job.Name, err)
-			}
-		}
-		if len(inputs) == 0 {
-			klog.Infof("No job inputs for %s", job.Name)
+	usage := make(map[string]clusterUsage)
+	for _, job := range prowJobs {
+		if mode := job.Annotations[annotationMode]; mode != JobTypeLaunch && mode != JobTypeWorkflowLaunch {
 			continue
 		}
-		architecture := job.Annotations["release.openshift.io/architecture"]
-		if len(architecture) == 0 {
-			architecture = "amd64"
-		}
-		buildCluster := job.Annotations["release.openshift.io/buildCluster"]
-		if len(buildCluster) == 0 {
-			buildCluster = job.Spec.Cluster
-		}
-		j := &Job{
-			Name:             job.Name,
-			State:            job.Status.State,
-			URL:              job.Status.URL,
-			OriginalMessage:  job.Annotations["ci-chat-bot.openshift.io/originalMessage"],
-			Mode:             job.Annotations["ci-chat-bot.openshift.io/mode"],
-			JobName:          job.Spec.Job,
-			Platform:         job.Annotations["ci-chat-bot.openshift.io/platform"],
-			Inputs:           inputs,
-			RequestedBy:      job.Annotations["ci-chat-bot.openshift.io/user"],
-			RequestedChannel: job.Annotations["ci-chat-bot.openshift.io/channel"],
-			RequestedAt:      job.CreationTimestamp.Time,
-			Architecture:     architecture,
-			BuildCluster:     buildCluster,
-		}
-
-		// This is a new annotation and there may be a brief window where not all
-		// prowjobs possess the annotation.
-		if targetType, ok := job.Annotations["ci-chat-bot.openshift.io/targetType"]; ok {
-			j.TargetType = targetType
-		} else {
-			j.TargetType = "template"
+		u := clusterUsage{user: job.Annotations[annotationUser], start: job.CreationTimestamp.Time}
+		if job.Status.CompletionTime != nil {
+			u.end = job.Status.CompletionTime.Time
 		}
+		usage[job.Name] = u
+	}
+	m.usage = usage
 
-		var err error
-		j.JobParams, err = paramsFromAnnotation(job.Annotations["ci-chat-bot.openshift.io/jobParams"])
-		if err != nil {
-			klog.Infof("Unable to unmarshal parameters from %s: %v", job.Name, err)
+	for _, job := range prowJobs {
+		previous := m.jobs[job.Name]
+
+		j, ok := jobFromProwJob(&job)
+		if !ok {
 			continue
 		}
 
-		if expirationString := job.Annotations["ci-chat-bot.openshift.io/expires"]; len(expirationString) > 0 {
-			if maxSeconds, err := strconv.Atoi(expirationString); err == nil && maxSeconds > 0 {
-				j.ExpiresAt = job.CreationTimestamp.Add(time.Duration(maxSeconds) * time.Second)
+		if previous != nil {
+			// the phase on the prow job is recorded after it changes, so the tracked job knows better
+			j.Phase = previous.Phase
+			j.Progress = previous.Progress
+			j.ProgressAt = previous.ProgressAt
+			j.Credentials = previous.Credentials
+			j.PasswordSnippet = previous.PasswordSnippet
+			j.Failure = previous.Failure
+			if len(j.ProgressMessage) == 0 {
+				j.ProgressMessage = previous.ProgressMessage
 			}
+			j.observePhase(job.Status.State)
 		}
+
 		if j.ExpiresAt.IsZero() {
-			j.ExpiresAt = job.CreationTimestamp.Time.Add(m.maxAge)
+			j.ExpiresAt = job.CreationTimestamp.Time.Add(m.lifetime(j))
 		}
 		if job.Status.CompletionTime != nil {
-			j.Complete = true
 			j.ExpiresAt = job.Status.CompletionTime.Add(15 * time.Minute)
+			if j.Phase == JobPhaseFailed && len(j.Failure) == 0 {
+				j.Failure = "job failed, see logs"
+			}
+			m.recordHistory(j, job.CreationTimestamp.Time, job.Status.CompletionTime.Time)
+		}
+		if m.extendEnabled && (j.Mode == JobTypeLaunch || j.Mode == JobTypeWorkflowLaunch) && job.Status.CompletionTime == nil && !j.Phase.Stopped() && j.ExpiresAt.Before(now) {
+			// the cluster runs until the bot stops it, which it has not done yet
+			j.ExpiresAt = now
 		}
 		if j.ExpiresAt.Before(now) {
 			continue
 		}
+		if j.Phase != JobPhase(job.Annotations[annotationPhase]) {
+			go m.recordPhase(j.Name, j.Phase)
+		}
 
 		switch job.Status.State {
-		case prowapiv1.FailureState:
-			j.Failure = "job failed, see logs"
-
+		case prowapiv1.AbortedState:
+			// only the bot aborts jobs, and it has told the owner already
 			m.jobs[job.Name] = j
-			if previous == nil || previous.State != j.State {
-				go m.finishedJob(*j)
+			if previous == nil || previous.Phase != j.Phase {
+				m.userChanged(j.RequestedBy)
 			}
-		case prowapiv1.SuccessState:
-			j.Failure = ""
-
+		case prowapiv1.FailureState, prowapiv1.ErrorState, prowapiv1.SuccessState:
 			m.jobs[job.Name] = j
 			if previous == nil || previous.State != j.State {
+				m.userChanged(j.RequestedBy)
 				go m.finishedJob(*j)
 			}
 
 		case prowapiv1.TriggeredState, prowapiv1.PendingState, "":
 			j.State = prowapiv1.PendingState
-			j.Failure = ""
 
-			if (j.Mode == JobTypeLaunch || j.Mode == JobTypeWorkflowLaunch) && (previous != nil && !previous.Complete) {
+			if (j.Mode == JobTypeLaunch || j.Mode == JobTypeWorkflowLaunch) && (previous != nil && !previous.Phase.Stopped()) {
 				if user := j.RequestedBy; len(user) > 0 {
-					if _, ok := m.requests[user]; !ok {
-						var inputStrings [][]string
-						for _, input := range inputs {
-							var current []string
-							switch {
-							case len(input.Version) > 0:
-								current = append(current, input.Version)
-							case len(input.Image) > 0:
-								current = append(current, input.Image)
-							}
-							for _, ref := range input.Refs {
-								for _, pull := range ref.Pulls {
-									current = append(current, fmt.Sprintf("%s/%s#%d", ref.Org, ref.Repo, pull.Number))
-								}
-							}
-							if len(current) > 0 {
-								inputStrings = append(inputStrings, current)
-							}
-						}
-						params, err := paramsFromAnnotation(job.Annotations["ci-chat-bot.openshift.io/jobParams"])
-						if err != nil {
-							klog.Infof("Unable to unmarshal parameters from %s: %v", job.Name, err)
-							continue
-						}
-
-						m.requests[user] = &JobRequest{
-							OriginalMessage: job.Annotations["ci-chat-bot.openshift.io/originalMessage"],
-
-							User:         user,
-							Name:         job.Name,
-							JobName:      job.Spec.Job,
-							Platform:     job.Annotations["ci-chat-bot.openshift.io/platform"],
-							JobParams:    params,
-							Inputs:       inputStrings,
-							RequestedAt:  job.CreationTimestamp.Time,
-							Channel:      job.Annotations["ci-chat-bot.openshift.io/channel"],
-							Architecture: architecture,
-						}
+					if _, ok := m.requests[requestKey(user, j.ClusterName)]; !ok {
+						m.requests[requestKey(user, j.ClusterName)] = requestFromJob(j, job.Annotations)
 					}
 				}
 			}
 
 			m.jobs[job.Name] = j
-			if previous == nil || previous.State != j.State || !previous.IsComplete() {
+			if previous == nil || previous.State != j.State {
+				m.userChanged(j.RequestedBy)
+			}
+			if !j.Phase.Stopped() && len(j.Credentials) == 0 {
 				go m.handleJobStartup(*j, "sync")
 			}
 		}
@@ -440,14 +658,24 @@ func (m *jobManager) sync() error {
 			delete(m.jobs, job.Name)
 		}
 	}
-	for _, req := range m.requests {
+	for key, req := range m.requests {
+		// requests on the waitlist stay until they are launched or cancelled, and requests
+		// for clusters that have been extended stay for as long as the cluster is tracked
+		if len(req.Name) == 0 {
+			continue
+		}
+		if _, ok := m.jobs[req.Name]; ok {
+			continue
+		}
 		if req.RequestedAt.Add(m.maxAge * 2).Before(now) {
-			klog.Infof("request %q is expired", req.User)
-			delete(m.requests, req.User)
+			klog.Infof("request %q is expired", key)
+			delete(m.requests, key)
 		}
 	}
 
-	klog.Infof("Job sync complete, %d jobs and %d requests", len(m.jobs), len(m.requests))
+	m.startWaitlistedJobs()
+
+	klog.Infof("Job sync complete, %d jobs, %d requests and %d waiting", len(m.jobs), len(m.requests), len(m.waitlist))
 	return nil
 }
 
@@ -457,6 +685,516 @@ func (m *jobManager) SetNotifier(fn JobCallbackFunc) {
 	m.notifierFn = fn
 }
 
+func (m *jobManager) SetMessageNotifier(fn MessageCallbackFunc) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.messageFn = fn
+}
+
+func (m *jobManager) SetUserNotifier(fn UserCallbackFunc) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.userFn = fn
+}
+
+func (m *jobManager) SetProgressNotifier(fn ProgressCallbackFunc) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.progressFn = fn
+}
+
+// reportProgress records that the launch of a cluster completed a step and tells the progress
+// notifier, unless the owner was already notified about the outcome of the launch.
+func (m *jobManager) reportProgress(job *Job, step LaunchStep) {
+	if job.Mode != JobTypeLaunch && job.Mode != JobTypeWorkflowLaunch {
+		return
+	}
+	job.Progress = step
+	// a step may be reported more than once, it was completed when it was first reported
+	if job.ProgressAt[step].IsZero() {
+		job.ProgressAt[step] = time.Now()
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if existing, ok := m.jobs[job.Name]; ok {
+		existing.Progress = step
+		existing.ProgressAt = job.ProgressAt
+	}
+	// the last step is reported again once the launch is over, which leaves the phase alone
+	if next := phaseForLaunchStep(step); !job.Phase.Stopped() && job.Phase.CanTransitionTo(next) {
+		m.setPhase(job, next)
+	}
+	if m.progressFn == nil || len(job.RequestedChannel) == 0 || len(job.RequestedBy) == 0 {
+		return
+	}
+	if existing, ok := m.jobs[job.Name]; ok && len(job.ProgressMessage) == 0 {
+		job.ProgressMessage = existing.ProgressMessage
+	}
+	notify, notified, estimate := m.progressFn, *job, m.estimateCompletion(time.Time{})
+	go func() {
+		if channel, id := notify(notified, estimate); len(id) > 0 {
+			m.recordProgressMessage(notified.Name, channel+"/"+id)
+		}
+	}()
+}
+
+// recordProgressMessage remembers the message the progress of a launch is shown in and records it
+// on the prow job, so the message is edited instead of posted again after a restart or takeover.
+func (m *jobManager) recordProgressMessage(name, message string) {
+	m.lock.Lock()
+	job, ok := m.jobs[name]
+	if !ok || job.ProgressMessage == message {
+		m.lock.Unlock()
+		return
+	}
+	job.ProgressMessage = message
+	m.lock.Unlock()
+
+	if err := m.annotateJob(name, map[string]string{annotationProgressMessage: message}); err != nil {
+		klog.Warningf("Job %q unable to record its progress message: %v", name, err)
+	}
+}
+
+// userChanged tells the user notifier that the clusters or jobs of the user changed. Caller must
+// hold the lock.
+func (m *jobManager) userChanged(user string) {
+	if len(user) == 0 || m.userFn == nil {
+		return
+	}
+	go m.userFn(user)
+}
+
+// sendMessage delivers an informational message to a channel. Caller must hold the lock.
+func (m *jobManager) sendMessage(channel, message string, actions ...MessageAction) {
+	m.sendThreadMessage(channel, "", message, actions...)
+}
+
+// sendThreadMessage delivers an informational message to a thread of a channel, or to the channel
+// itself if thread is empty. Caller must hold the lock.
+func (m *jobManager) sendThreadMessage(channel, thread, message string, actions ...MessageAction) {
+	if len(channel) == 0 || m.messageFn == nil {
+		return
+	}
+	go m.messageFn(channel, thread, message, actions...)
+}
+
+// launchedClusters returns the number of clusters that are running or starting. Caller must
+// hold the lock.
+func (m *jobManager) launchedClusters() int {
+	var count int
+	for _, job := range m.jobs {
+		if job != nil && (job.Mode == JobTypeLaunch || job.Mode == JobTypeWorkflowLaunch) && !job.Phase.Stopped() {
+			count++
+		}
+	}
+	return count
+}
+
+// launchedClustersOn returns the number of clusters that are running or starting on the platform,
+// and how many of those use the given architecture. Caller must hold the lock.
+func (m *jobManager) launchedClustersOn(platform, architecture string) (int, int) {
+	var onPlatform, onArchitecture int
+	for _, job := range m.jobs {
+		if job == nil || (job.Mode != JobTypeLaunch && job.Mode != JobTypeWorkflowLaunch) || job.Phase.Stopped() {
+			continue
+		}
+		if job.Platform != platform {
+			continue
+		}
+		onPlatform++
+		if jobArchitecture(job) == architecture {
+			onArchitecture++
+		}
+	}
+	return onPlatform, onArchitecture
+}
+
+func jobArchitecture(job *Job) string {
+	if len(job.Architecture) == 0 {
+		return "amd64"
+	}
+	return job.Architecture
+}
+
+// hasCapacity returns true if the job can be started without exceeding the total number of
+// clusters or the limits of its platform, taking slots held for active reservations into account.
+// Caller must hold the lock.
+func (m *jobManager) hasCapacity(job *Job) bool {
+	heldTotal, heldOnPlatform := m.heldCapacity(job, time.Now())
+	if m.launchedClusters()+heldTotal >= m.maxClusters {
+		return false
+	}
+	if m.capacity == nil {
+		return true
+	}
+	architecture := jobArchitecture(job)
+	platformLimit, architectureLimit := m.capacity.Limits(job.Platform, architecture)
+	onPlatform, onArchitecture := m.launchedClustersOn(job.Platform, architecture)
+	if platformLimit > 0 && onPlatform+heldOnPlatform >= platformLimit {
+		return false
+	}
+	if architectureLimit > 0 && onArchitecture >= architectureLimit {
+		return false
+	}
+	return true
+}
+
+// waitlistedOn returns true if a request for the same platform with at least the given priority is
+// already waiting. Caller must hold the lock.
+func (m *jobManager) waitlistedOn(platform string, priority Priority) bool {
+	for _, entry := range m.waitlist {
+		if entry.job.Platform == platform && entry.request.Priority >= priority {
+			return true
+		}
+	}
+	return false
+}
+
+// addToWaitlist queues the request behind every request of the same or higher priority and
+// returns its position. Users that are moved back are told their new position. Caller must hold
+// the lock.
+func (m *jobManager) addToWaitlist(req *JobRequest, job *Job) int {
+	index := len(m.waitlist)
+	for i, entry := range m.waitlist {
+		if entry.request.Priority < req.Priority {
+			index = i
+			break
+		}
+	}
+	m.waitlist = append(m.waitlist, waitlistEntry{})
+	copy(m.waitlist[index+1:], m.waitlist[index:])
+	m.waitlist[index] = waitlistEntry{request: req, job: job}
+	m.setPhase(job, JobPhaseQueued)
+	m.notifyWaitlistPositions(index + 1)
+	m.userChanged(req.User)
+	return index + 1
+}
+
+// preemptionCandidate returns the oldest running normal priority cluster that has been up for
+// longer than the grace period and whose shutdown would make room for the job, or nil if
+// preemption is disabled or no cluster qualifies. Clusters approved for a longer lifetime are
+// never preempted, and neither is any cluster if the job only lacks room because of slots held
+// for reservations. Caller must hold the lock.
+func (m *jobManager) preemptionCandidate(job *Job, now time.Time) *Job {
+	if m.priority == nil {
+		return nil
+	}
+	enabled, gracePeriod := m.priority.Preemption()
+	if !enabled {
+		return nil
+	}
+
+	architecture := jobArchitecture(job)
+	var platformLimit, architectureLimit int
+	if m.capacity != nil {
+		platformLimit, architectureLimit = m.capacity.Limits(job.Platform, architecture)
+	}
+	heldTotal, heldOnPlatform := m.heldCapacity(job, now)
+	launched := m.launchedClusters()
+	onPlatform, onArchitecture := m.launchedClustersOn(job.Platform, architecture)
+	// fitsWithout returns true if the job can start once the given cluster is shut down
+	fitsWithout := func(running *Job) bool {
+		freedPlatform, freedArchitecture := 0, 0
+		if running.Platform == job.Platform {
+			freedPlatform = 1
+			if jobArchitecture(running) == architecture {
+				freedArchitecture = 1
+			}
+		}
+		return launched-1+heldTotal < m.maxClusters &&
+			(platformLimit <= 0 || onPlatform-freedPlatform+heldOnPlatform < platformLimit) &&
+			(architectureLimit <= 0 || onArchitecture-freedArchitecture < architectureLimit)
+	}
+	// the held slots belong to the owners of the reservations, shutting down a cluster for them
+	// would not give the job a slot
+	if launched < m.maxClusters && (platformLimit <= 0 || onPlatform < platformLimit) && (architectureLimit <= 0 || onArchitecture < architectureLimit) {
+		return nil
+	}
+
+	var candidate *Job
+	for _, running := range m.jobs {
+		if running.Mode != JobTypeLaunch && running.Mode != JobTypeWorkflowLaunch {
+			continue
+		}
+		if running.Phase.Stopped() || running.Priority >= PriorityHigh || len(running.ApprovedBy) > 0 {
+			continue
+		}
+		if now.Sub(running.RequestedAt) < gracePeriod {
+			continue
+		}
+		if !fitsWithout(running) {
+			continue
+		}
+		if candidate == nil || running.RequestedAt.Before(candidate.RequestedAt) {
+			candidate = running
+		}
+	}
+	return candidate
+}
+
+// preemptJob shuts down a cluster to make room for a priority request and lets its owner know.
+func (m *jobManager) preemptJob(job Job) {
+	if err := m.stopJob(job.Name, job.BuildCluster); err != nil {
+		klog.Errorf("Job %q could not be preempted: %v", job.Name, err)
+	}
+	msg := "your cluster was shut down to make room for a priority request, sorry for the disruption. You may launch another when capacity is available"
+	if len(job.ClusterName) > 0 {
+		msg = fmt.Sprintf("your cluster `%s` was shut down to make room for a priority request, sorry for the disruption. You may launch another when capacity is available", job.ClusterName)
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.sendMessage(job.RequestedBy, msg)
+}
+
+// lifetime returns how long the cluster runs for before any extension.
+func (m *jobManager) lifetime(job *Job) time.Duration {
+	if job.Lifetime > 0 {
+		return job.Lifetime
+	}
+	return m.maxAge
+}
+
+// maxLifetimeFor returns how long the cluster may run for including extensions. Clusters approved
+// for a longer lifetime may run for at least that long.
+func (m *jobManager) maxLifetimeFor(job *Job) time.Duration {
+	if job.Lifetime > m.maxLifetime {
+		return job.Lifetime
+	}
+	return m.maxLifetime
+}
+
+func priorityFromAnnotation(value string) Priority {
+	if value == "high" {
+		return PriorityHigh
+	}
+	return PriorityNormal
+}
+
+// capacitySummary reports the usage of every platform with a configured limit, for example
+// "aws 12/20, metal 3/4". Caller must hold the lock.
+func (m *jobManager) capacitySummary() string {
+	if m.capacity == nil {
+		return ""
+	}
+	platforms := m.capacity.Snapshot()
+	var names []string
+	for name := range platforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		capacity := platforms[name]
+		onPlatform, _ := m.launchedClustersOn(name, "")
+		var part string
+		if capacity.Limit > 0 {
+			part = fmt.Sprintf("%s %d/%d", name, onPlatform, capacity.Limit)
+		} else {
+			part = fmt.Sprintf("%s %d", name, onPlatform)
+		}
+		var architectures []string
+		for architecture := range capacity.Architectures {
+			architectures = append(architectures, architecture)
+		}
+		sort.Strings(architectures)
+		var architectureParts []string
+		for _, architecture := range architectures {
+			_, onArchitecture := m.launchedClustersOn(name, architecture)
+			architectureParts = append(architectureParts, fmt.Sprintf("%s %d/%d", architecture, onArchitecture, capacity.Architectures[architecture]))
+		}
+		if len(architectureParts) > 0 {
+			part += fmt.Sprintf(" (%s)", strings.Join(architectureParts, ", "))
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// requestKey identifies a cluster request by the user who made it and the optional cluster name.
+func requestKey(user, name string) string {
+	if len(name) == 0 {
+		return user
+	}
+	return fmt.Sprintf("%s/%s", user, name)
+}
+
+// clusterDescription refers to a cluster by name in messages to the user.
+func clusterDescription(name string) string {
+	if len(name) == 0 {
+		return "a cluster"
+	}
+	return fmt.Sprintf("a cluster named `%s`", name)
+}
+
+// requestForUser finds the cluster request a user made with the given name. If no name is
+// given and the user has a single cluster, that request is returned whatever its name. It
+// returns nil if no matching request exists. Caller must hold the lock.
+func (m *jobManager) requestForUser(user, name string) (*JobRequest, error) {
+	if req, ok := m.requests[requestKey(user, name)]; ok || len(name) > 0 {
+		return req, nil
+	}
+	var found *JobRequest
+	var names []string
+	for _, req := range m.requests {
+		if req.User != user {
+			continue
+		}
+		found = req
+		names = append(names, req.ClusterName)
+	}
+	if len(names) > 1 {
+		sort.Strings(names)
+		return nil, fmt.Errorf("you have %d clusters, specify which one you mean: %s", len(names), strings.Join(codeSlice(names), ", "))
+	}
+	return found, nil
+}
+
+// activeClustersForUser counts the clusters a user has requested that are waiting, starting or
+// running, ignoring the request with the given key. Caller must hold the lock.
+func (m *jobManager) activeClustersForUser(user, ignoreKey string) int {
+	var count int
+	for key, req := range m.requests {
+		if req.User != user || key == ignoreKey || len(req.Reservation) > 0 {
+			continue
+		}
+		if len(req.Name) > 0 {
+			if job, ok := m.jobs[req.Name]; !ok || job.Phase.Stopped() {
+				continue
+			}
+		}
+		count++
+	}
+	return count
+}
+
+// waitlistPosition returns the 1-based position of the request in the waitlist, or 0 if the
+// request is not waiting. Caller must hold the lock.
+func (m *jobManager) waitlistPosition(req *JobRequest) int {
+	for i, entry := range m.waitlist {
+		if entry.request == req {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// estimateWaitlistStart guesses how long the request at the given waitlist position will wait
+// before a slot is free, based on when the currently running clusters expire. Caller must hold
+// the lock.
+func (m *jobManager) estimateWaitlistStart(position int) time.Duration {
+	var expirations []time.Time
+	for _, job := range m.jobs {
+		if job == nil || (job.Mode != JobTypeLaunch && job.Mode != JobTypeWorkflowLaunch) || job.Phase.Stopped() {
+			continue
+		}
+		expirations = append(expirations, job.ExpiresAt)
+	}
+	if len(expirations) == 0 {
+		return 0
+	}
+	sort.Slice(expirations, func(i, j int) bool { return expirations[i].Before(expirations[j]) })
+	if position > len(expirations) {
+		position = len(expirations)
+	}
+	wait := expirations[position-1].Sub(time.Now())
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// waitlistMessage describes the position of a user in the waitlist. Caller must hold the lock.
+func (m *jobManager) waitlistMessage(position int) string {
+	minutes := int(math.Ceil(m.estimateWaitlistStart(position).Minutes()))
+	if minutes < 1 {
+		return fmt.Sprintf("you are #%d on the waitlist, unable to estimate when the next cluster will be free", position)
+	}
+	return fmt.Sprintf("you are #%d on the waitlist, a slot should be available in about %d minutes", position, minutes)
+}
+
+// removeFromWaitlist drops the request from the waitlist and notifies the users behind it of
+// their new position. Caller must hold the lock.
+func (m *jobManager) removeFromWaitlist(req *JobRequest) bool {
+	position := m.waitlistPosition(req)
+	if position == 0 {
+		return false
+	}
+	m.waitlist = append(m.waitlist[:position-1], m.waitlist[position:]...)
+	m.notifyWaitlistPositions(position - 1)
+	m.userChanged(req.User)
+	return true
+}
+
+// notifyWaitlistPositions tells every waiting user at or after the given index their updated
+// position. Caller must hold the lock.
+func (m *jobManager) notifyWaitlistPositions(from int) {
+	for i := from; i < len(m.waitlist); i++ {
+		req := m.waitlist[i].request
+		m.sendThreadMessage(req.Channel, req.Thread, fmt.Sprintf("Waitlist update: %s", m.waitlistMessage(i+1)))
+	}
+}
+
+// startWaitlistedJobs launches requests from the waitlist in order for as long as cluster slots
+// are available. Requests for a platform that is at its limit are skipped so they do not hold up
+// requests for other platforms. Caller must hold the lock.
+func (m *jobManager) startWaitlistedJobs() {
+	var started int
+	for i := 0; i < len(m.waitlist) && m.launchedClusters() < m.maxClusters; {
+		entry := m.waitlist[i]
+		req, job := entry.request, entry.job
+		if current, ok := m.requests[requestKey(req.User, req.ClusterName)]; !ok || current != req {
+			klog.Infof("waitlisted request for %q was cancelled", requestKey(req.User, req.ClusterName))
+			m.waitlist = append(m.waitlist[:i], m.waitlist[i+1:]...)
+			started++
+			continue
+		}
+		if !m.hasCapacity(job) {
+			i++
+			continue
+		}
+		m.waitlist = append(m.waitlist[:i], m.waitlist[i+1:]...)
+		started++
+
+		// the job is renamed so that its name and expiration reflect the actual start
+		req.RequestedAt = time.Now()
+		req.Name = m.jobNameForTime(req.RequestedAt)
+		for m.jobs[req.Name] != nil {
+			req.RequestedAt = req.RequestedAt.Add(time.Millisecond)
+			req.Name = m.jobNameForTime(req.RequestedAt)
+		}
+		job.Name = req.Name
+		job.RequestedAt = req.RequestedAt
+		job.ExpiresAt = req.RequestedAt.Add(m.lifetime(job))
+		m.setPhase(job, JobPhaseCreating)
+		m.jobs[job.Name] = job
+		m.userChanged(req.User)
+
+		klog.Infof("Job %q starting waitlisted cluster for %q", job.Name, req.User)
+		go m.startWaitlistedJob(*job)
+	}
+	if started > 0 {
+		m.notifyWaitlistPositions(0)
+	}
+}
+
+// startWaitlistedJob creates the prow job for a request that was taken off the waitlist.
+func (m *jobManager) startWaitlistedJob(job Job) {
+	prowJobURL, err := m.newJob(&job)
+	if err != nil {
+		klog.Errorf("Job %q could not be started from the waitlist: %v", job.Name, err)
+		job.Failure = fmt.Sprintf("the requested job cannot be started: %v", err)
+		m.finishedJob(job)
+		return
+	}
+
+	m.lock.Lock()
+	m.sendThreadMessage(job.RequestedChannel, job.RequestedThread, fmt.Sprintf("a cluster slot is now available and your <%s|cluster is being created> - I'll send you the credentials in about %d minutes", prowJobURL, m.estimateCompletion(job.RequestedAt)/time.Minute))
+	m.lock.Unlock()
+
+	m.handleJobStartup(job, "waitlist")
+}
+
 func (m *jobManager) estimateCompletion(requestedAt time.Time) time.Duration {
 	// find the median, or default to 30m
 	var median time.Duration
@@ -487,6 +1225,121 @@ func contains(arr []string, s string) bool {
 	return false
 }
 
+// describeInputs summarizes the release and pull requests a job was launched from as links.
+func describeInputs(job *Job) string {
+	var inputParts []string
+	var jobInput JobInput
+	if len(job.Inputs) > 0 {
+		jobInput = job.Inputs[0]
+	}
+	switch {
+	case len(jobInput.Version) > 0:
+		inputParts = append(inputParts, fmt.Sprintf("<https://amd64.ocp.releases.ci.openshift.org/releasetag/%s|%s>", url.PathEscape(jobInput.Version), jobInput.Version))
+	case len(jobInput.Image) > 0:
+		inputParts = append(inputParts, "(image)")
+	}
+	for _, ref := range jobInput.Refs {
+		for _, pull := range ref.Pulls {
+			inputParts = append(inputParts, fmt.Sprintf(" <https://github.com/%s/%s/pull/%d|%s/%s#%d>", url.PathEscape(ref.Org), url.PathEscape(ref.Repo), pull.Number, ref.Org, ref.Repo, pull.Number))
+		}
+	}
+	return strings.Join(inputParts, ",")
+}
+
+// describeParams summarizes the platform and parameters of a job.
+func describeParams(job *Job) string {
+	params := make(map[string]string)
+	for k, v := range job.JobParams {
+		params[k] = v
+	}
+	if len(job.Platform) > 0 {
+		params[job.Platform] = ""
+	}
+	return paramsToString(params)
+}
+
+// JobsForUser returns the clusters and jobs of the user that are still tracked, most recent first.
+func (m *jobManager) JobsForUser(user string) []Job {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var jobs []Job
+	for _, job := range m.jobs {
+		if job.RequestedBy == user {
+			jobs = append(jobs, *job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].RequestedAt.After(jobs[j].RequestedAt) })
+	return jobs
+}
+
+// JobForLink returns the job a prow link points to, either the page of the prow job or the logs of
+// its run. Jobs that are no longer tracked are restored from their prow job.
+func (m *jobManager) JobForLink(link string) (*Job, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+	name := u.Query().Get("prowjob")
+	if len(name) > 0 && !strings.HasPrefix(name, m.clusterPrefix) {
+		return nil, fmt.Errorf("%s was not launched by the bot", name)
+	}
+	sameURL := func(jobURL string) bool {
+		return len(jobURL) > 0 && strings.TrimSuffix(jobURL, "/") == strings.TrimSuffix(link, "/")
+	}
+
+	m.lock.Lock()
+	for _, job := range m.jobs {
+		if job.Name == name || sameURL(job.URL) {
+			copied := *job
+			m.lock.Unlock()
+			return &copied, nil
+		}
+	}
+	m.lock.Unlock()
+
+	var prowJobs []prowapiv1.ProwJob
+	if len(name) > 0 {
+		pj, err := m.getProwJob(name)
+		if err != nil {
+			return nil, err
+		}
+		prowJobs = append(prowJobs, *pj)
+	} else {
+		if prowJobs, err = m.listProwJobs(); err != nil {
+			return nil, err
+		}
+	}
+	for i := range prowJobs {
+		pj := &prowJobs[i]
+		if pj.Name != name && !sameURL(pj.Status.URL) {
+			continue
+		}
+		job, ok := jobFromProwJob(pj)
+		if !ok {
+			break
+		}
+		return job, nil
+	}
+	return nil, fmt.Errorf("no job found for %s", link)
+}
+
+// CapacitySummary describes how many clusters are up, how long they take to start and the usage
+// of each platform.
+func (m *jobManager) CapacitySummary() string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	summary := fmt.Sprintf("%d/%d clusters up, start time is approximately %d minutes", m.launchedClusters(), m.maxClusters, m.estimateCompletion(time.Time{})/time.Minute)
+	if len(m.waitlist) > 0 {
+		summary += fmt.Sprintf(", %d requests waiting for a cluster", len(m.waitlist))
+	}
+	if platforms := m.capacitySummary(); len(platforms) > 0 {
+		summary += fmt.Sprintf("\nCapacity by platform: %s", platforms)
+	}
+	return summary
+}
+
 func (m *jobManager) ListJobs(users ...string) string {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -497,7 +1350,7 @@ func (m *jobManager) ListJobs(users ...string) string {
 	var runningClusters int
 	for _, job := range m.jobs {
 		if job.Mode == JobTypeLaunch || job.Mode == JobTypeWorkflowLaunch {
-			if !job.Complete {
+			if !job.Phase.Stopped() {
 				runningClusters++
 			}
 			clusters = append(clusters, job)
@@ -533,74 +1386,64 @@ func (m *jobManager) ListJobs(users ...string) string {
 		fmt.Fprintf(buf, "No clusters up (start time is approximately %d minutes):\n\n", m.estimateCompletion(time.Time{})/time.Minute)
 	} else {
 		fmt.Fprintf(buf, "%d/%d clusters up (start time is approximately %d minutes):\n\n", runningClusters, m.maxClusters, m.estimateCompletion(time.Time{})/time.Minute)
+		if summary := m.capacitySummary(); len(summary) > 0 {
+			fmt.Fprintf(buf, "Capacity by platform: %s\n\n", summary)
+		}
 		for _, job := range clusters {
 			var details string
 			if len(job.URL) > 0 {
 				details = fmt.Sprintf(", <%s|view logs>", job.URL)
 			}
-			var imageOrVersion string
-			var inputParts []string
-			var jobInput JobInput
-			if len(job.Inputs) > 0 {
-				jobInput = job.Inputs[0]
-			}
-			switch {
-			case len(jobInput.Version) > 0:
-				inputParts = append(inputParts, fmt.Sprintf("<https://amd64.ocp.releases.ci.openshift.org/releasetag/%s|%s>", url.PathEscape(jobInput.Version), jobInput.Version))
-			case len(jobInput.Image) > 0:
-				inputParts = append(inputParts, "(image)")
+			imageOrVersion := describeInputs(job)
+			if len(job.ClusterName) > 0 {
+				imageOrVersion = fmt.Sprintf(" `%s` %s", job.ClusterName, imageOrVersion)
 			}
-			for _, ref := range jobInput.Refs {
-				for _, pull := range ref.Pulls {
-					inputParts = append(inputParts, fmt.Sprintf(" <https://github.com/%s/%s/pull/%d|%s/%s#%d>", url.PathEscape(ref.Org), url.PathEscape(ref.Repo), pull.Number, ref.Org, ref.Repo, pull.Number))
-				}
-			}
-			imageOrVersion = strings.Join(inputParts, ",")
-
-			// summarize the job parameters
 			var options string
-			params := make(map[string]string)
-			for k, v := range job.JobParams {
-				params[k] = v
-			}
-			if len(job.Platform) > 0 {
-				params[job.Platform] = ""
-			}
-			if s := paramsToString(params); len(s) > 0 {
+			if s := describeParams(job); len(s) > 0 {
 				options = fmt.Sprintf(" (%s)", s)
 			}
 
-			switch {
-			case job.State == prowapiv1.SuccessState:
+			switch job.Phase {
+			case JobPhaseSucceeded, JobPhaseExpired:
 				fmt.Fprintf(buf, "• <@%s>%s - cluster has been shut down%s\n", job.RequestedBy, imageOrVersion, details)
-			case job.State == prowapiv1.FailureState:
-				fmt.Fprintf(buf, "• <@%s>%s%s - cluster failed to start%s\n", job.RequestedBy, imageOrVersion, options, details)
-			case job.Complete:
-				fmt.Fprintf(buf, "• <@%s>%s%s - cluster has requested shut down%s\n", job.RequestedBy, imageOrVersion, options, details)
-			case len(job.Credentials) > 0:
+			case JobPhaseFailed:
+				if job.State == prowapiv1.FailureState || len(job.Failure) == 0 {
+					fmt.Fprintf(buf, "• <@%s>%s%s - cluster failed to start%s\n", job.RequestedBy, imageOrVersion, options, details)
+				} else {
+					fmt.Fprintf(buf, "• <@%s>%s%s - failure: %s%s\n", job.RequestedBy, imageOrVersion, options, job.Failure, details)
+				}
+			case JobPhaseTearingDown:
+				if len(job.StopReason) > 0 {
+					fmt.Fprintf(buf, "• <@%s>%s%s - cluster has been %s%s\n", job.RequestedBy, imageOrVersion, options, job.StopReason, details)
+				} else {
+					fmt.Fprintf(buf, "• <@%s>%s%s - cluster has requested shut down%s\n", job.RequestedBy, imageOrVersion, options, details)
+				}
+			case JobPhaseReady:
 				fmt.Fprintf(buf, "• <@%s>%s%s - available and will be torn down in %d minutes%s\n", job.RequestedBy, imageOrVersion, options, int(job.ExpiresAt.Sub(now)/time.Minute), details)
-			case len(job.Failure) > 0:
-				fmt.Fprintf(buf, "• <@%s>%s%s - failure: %s%s\n", job.RequestedBy, imageOrVersion, options, job.Failure, details)
 			default:
-				fmt.Fprintf(buf, "• <@%s>%s%s - starting, %d minutes elapsed%s\n", job.RequestedBy, imageOrVersion, options, int(now.Sub(job.RequestedAt)/time.Minute), details)
+				fmt.Fprintf(buf, "• <@%s>%s%s - starting (%s), %d minutes elapsed%s\n", job.RequestedBy, imageOrVersion, options, phaseDescription(job), int(now.Sub(job.RequestedAt)/time.Minute), details)
 			}
 		}
 		fmt.Fprintf(buf, "\n")
 	}
 
+	if len(m.waitlist) > 0 {
+		fmt.Fprintf(buf, "%d requests waiting for a cluster:\n\n", len(m.waitlist))
+		for i, entry := range m.waitlist {
+			fmt.Fprintf(buf, "%d. <@%s> - waiting for %d minutes\n", i+1, entry.request.User, int(now.Sub(entry.request.RequestedAt)/time.Minute))
+		}
+		fmt.Fprintf(buf, "\n")
+	}
+
 	if len(jobs) > 0 {
 		fmt.Fprintf(buf, "Running jobs:\n\n")
 		for _, job := range jobs {
 			fmt.Fprintf(buf, "• %d minutes ago - ", int(now.Sub(job.RequestedAt)/time.Minute))
-			switch {
-			case job.State == prowapiv1.SuccessState:
-				fmt.Fprint(buf, "*succeeded* ")
-			case job.State == prowapiv1.FailureState:
-				fmt.Fprint(buf, "*failed* ")
-			case len(job.URL) > 0:
-				fmt.Fprint(buf, "running ")
+			switch job.Phase {
+			case JobPhaseSucceeded, JobPhaseFailed:
+				fmt.Fprintf(buf, "*%s* ", phaseDescription(job))
 			default:
-				fmt.Fprint(buf, "pending ")
+				fmt.Fprintf(buf, "%s ", phaseDescription(job))
 			}
 			var details string
 			switch {
@@ -628,15 +1471,21 @@ func (m *jobManager) ListJobs(users ...string) string {
 
 type callbackFunc func(job Job)
 
-func (m *jobManager) GetLaunchJob(user string) (*Job, error) {
+func (m *jobManager) GetLaunchJob(user, name string) (*Job, error) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	existing, ok := m.requests[user]
-	if !ok {
-		return nil, fmt.Errorf("you haven't requested a cluster or your cluster expired")
+	existing, err := m.requestForUser(user, name)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, fmt.Errorf("you haven't requested %s or your cluster expired", clusterDescription(name))
 	}
 	if len(existing.Name) == 0 {
+		if position := m.waitlistPosition(existing); position > 0 {
+			return nil, fmt.Errorf("%s", m.waitlistMessage(position))
+		}
 		return nil, fmt.Errorf("you are still on the waitlist")
 	}
 	job, ok := m.jobs[existing.Name]
@@ -985,6 +1834,10 @@ func (m *jobManager) resolveAsPullRequest(spec string) (*prowapiv1.Refs, error)
 	}, nil
 }
 
+func (m *jobManager) jobNameForTime(t time.Time) string {
+	return fmt.Sprintf("%s%s", m.clusterPrefix, t.UTC().Format("2006-01-02-150405.9999"))
+}
+
 func (m *jobManager) resolveToJob(req *JobRequest) (*Job, error) {
 	user := req.User
 	if len(user) == 0 {
@@ -996,7 +1849,7 @@ func (m *jobManager) resolveToJob(req *JobRequest) (*Job, error) {
 	}
 
 	req.RequestedAt = time.Now()
-	name := fmt.Sprintf("%s%s", m.clusterPrefix, req.RequestedAt.UTC().Format("2006-01-02-150405.9999"))
+	name := m.jobNameForTime(req.RequestedAt)
 	req.Name = name
 
 	job := &Job{
@@ -1009,13 +1862,19 @@ func (m *jobManager) resolveToJob(req *JobRequest) (*Job, error) {
 
 		RequestedBy:      user,
 		RequestedChannel: req.Channel,
+		RequestedThread:  req.Thread,
+		ClusterName:      req.ClusterName,
+		Priority:         req.Priority,
+		Reservation:      req.Reservation,
 		RequestedAt:      req.RequestedAt,
 
-		ExpiresAt: req.RequestedAt.Add(m.maxAge),
+		Lifetime:   req.Lifetime,
+		ApprovedBy: req.ApprovedBy,
 
 		Architecture: req.Architecture,
 		WorkflowName: req.WorkflowName,
 	}
+	job.ExpiresAt = req.RequestedAt.Add(m.lifetime(job))
 
 	// default install type jobs to "ci"
 	if len(req.Inputs) == 0 && req.Type == JobTypeInstall {
@@ -1158,7 +2017,43 @@ func configContainsVariant(params map[string]string, platform, unresolvedConfig,
 	return false, "", nil
 }
 
+// VariantsForPlatform returns the variants that can be requested when launching a cluster on the
+// platform. Variants that are not part of the launch configuration of the platform are left out.
+func (m *jobManager) VariantsForPlatform(platform string) []string {
+	var config string
+	selector := labels.Set{"job-env": platform, "job-type": JobTypeLaunch, "config-type": "modern"}
+	if prowJob, _ := prow.JobForLabels(m.prowConfigLoader, labels.SelectorFromSet(selector)); prowJob != nil {
+		if env, _, ok := firstEnvVar(prowJob.Spec.PodSpec, "UNRESOLVED_CONFIG"); ok {
+			config = env.Value
+		}
+	}
+	platformParams := multistageParamsForPlatform(platform)
+	var variants []string
+	for _, param := range supportedParameters {
+		switch {
+		case param == "test":
+			continue
+		case platformParams.Has(param), len(config) == 0:
+		default:
+			if ok, _, err := configContainsVariant(map[string]string{param: ""}, platform, config, JobTypeLaunch); err != nil || !ok {
+				continue
+			}
+		}
+		variants = append(variants, param)
+	}
+	return variants
+}
+
 func (m *jobManager) LaunchJobForUser(req *JobRequest) (string, error) {
+	if req.Lifetime > 0 {
+		if req.Lifetime < 30*time.Minute {
+			return "", fmt.Errorf("clusters must run for at least 30 minutes")
+		}
+		if req.Lifetime > m.maxApprovedLifetime && len(req.Reservation) == 0 {
+			return "", fmt.Errorf("clusters may not run for longer than %s", m.maxApprovedLifetime)
+		}
+	}
+
 	job, err := m.resolveToJob(req)
 	if err != nil {
 		return "", err
@@ -1204,57 +2099,79 @@ func (m *jobManager) LaunchJobForUser(req *JobRequest) (string, error) {
 
 	klog.Infof("Job %q requested by user %q with mode %s prow job %s(%s) - params=%s, inputs=%#v", job.Name, req.User, job.Mode, job.JobName, job.BuildCluster, paramsToString(job.JobParams), job.Inputs)
 
+	var preempted *Job
 	msg, err := func() (string, error) {
 		m.lock.Lock()
 		defer m.lock.Unlock()
 
 		user := req.User
 		if job.Mode == JobTypeLaunch || job.Mode == JobTypeWorkflowLaunch {
-			existing, ok := m.requests[user]
+			key := requestKey(user, req.ClusterName)
+			existing, ok := m.requests[key]
 			if ok {
 				if len(existing.Name) == 0 {
-					klog.Infof("user %q already requested cluster", user)
-					return "", fmt.Errorf("you have already requested a cluster and it should be ready in ~ %d minutes", m.estimateCompletion(existing.RequestedAt)/time.Minute)
+					klog.Infof("user %q already requested cluster", key)
+					if position := m.waitlistPosition(existing); position > 0 {
+						return "", fmt.Errorf("you have already requested %s, %s", clusterDescription(req.ClusterName), m.waitlistMessage(position))
+					}
+					return "", fmt.Errorf("you have already requested %s and it should be ready in ~ %d minutes", clusterDescription(req.ClusterName), m.estimateCompletion(existing.RequestedAt)/time.Minute)
 				}
 				if job, ok := m.jobs[existing.Name]; ok {
-					if len(job.Credentials) > 0 {
-						klog.Infof("user %q cluster is already up", user)
+					if job.Phase == JobPhaseReady {
+						klog.Infof("user %q cluster is already up", key)
+						if len(req.ClusterName) > 0 {
+							return fmt.Sprintf("your cluster `%s` is already running, see your credentials again with the 'auth %s' command", req.ClusterName, req.ClusterName), nil
+						}
 						return "your cluster is already running, see your credentials again with the 'auth' command", nil
 					}
-					if len(job.Failure) == 0 {
-						klog.Infof("user %q cluster has no credentials yet", user)
-						return "", fmt.Errorf("you have already requested a cluster and it should be ready in ~ %d minutes", m.estimateCompletion(existing.RequestedAt)/time.Minute)
+					if !job.Phase.Stopped() {
+						klog.Infof("user %q cluster has no credentials yet", key)
+						return "", fmt.Errorf("you have already requested %s and it should be ready in ~ %d minutes", clusterDescription(req.ClusterName), m.estimateCompletion(existing.RequestedAt)/time.Minute)
 					}
 
-					klog.Infof("user %q cluster failed, allowing them to request another", user)
+					klog.Infof("user %q cluster failed, allowing them to request another", key)
 					delete(m.jobs, existing.Name)
-					delete(m.requests, user)
+					delete(m.requests, key)
 				}
 			}
-			m.requests[user] = req
-
-			launchedClusters := 0
-			for _, job := range m.jobs {
-				if job != nil && (job.Mode == JobTypeLaunch || job.Mode == JobTypeWorkflowLaunch) && !job.Complete && len(job.Failure) == 0 {
-					launchedClusters++
+			if clusters := m.activeClustersForUser(user, key); clusters >= maxClustersPerUser && len(req.Reservation) == 0 {
+				return "", fmt.Errorf("you can't have more than %d clusters at a time, use `done NAME` to shut one down first", maxClustersPerUser)
+			}
+			if m.quota > 0 && len(req.Reservation) == 0 {
+				if used, _ := m.usageForUser(user, time.Now()); used >= m.quota {
+					klog.Infof("user %q has exceeded their quota", user)
+					return "", fmt.Errorf("you have used %.1f of your %.0f cluster-hours in the last %s, you will be able to launch more clusters as older ones fall out of that window. Use the `quota` command to check your usage", used.Hours(), m.quota.Hours(), m.quotaWindowDescription())
 				}
 			}
-			if launchedClusters >= m.maxClusters {
-				klog.Infof("user %q is will have to wait", user)
-				var waitUntil time.Time
-				for _, c := range m.jobs {
-					if c == nil || (c.Mode != JobTypeLaunch && c.Mode != JobTypeWorkflowLaunch) {
-						continue
-					}
-					if waitUntil.Before(c.ExpiresAt) {
-						waitUntil = c.ExpiresAt
+			if req.Lifetime > m.maxAge && len(req.ApprovedBy) == 0 && len(req.Reservation) == 0 {
+				return m.requestApproval(req)
+			}
+			m.requests[key] = req
+
+			// priority requests may take the place of an older normal cluster
+			if !m.hasCapacity(job) && req.Priority >= PriorityHigh && !m.waitlistedOn(job.Platform, req.Priority) {
+				if candidate := m.preemptionCandidate(job, time.Now()); candidate != nil {
+					klog.Infof("Job %q is preempted by priority request from %q", candidate.Name, user)
+					candidate.Failure = "preempted by a priority request"
+					candidate.ExpiresAt = time.Now().Add(15 * time.Minute)
+					m.setPhase(candidate, JobPhaseTearingDown)
+					if existing, ok := m.requests[requestKey(candidate.RequestedBy, candidate.ClusterName)]; ok && existing.Name == candidate.Name {
+						delete(m.requests, requestKey(candidate.RequestedBy, candidate.ClusterName))
 					}
+					copied := *candidate
+					preempted = &copied
 				}
-				minutes := waitUntil.Sub(time.Now()).Minutes()
-				if minutes < 1 {
-					return "", fmt.Errorf("no clusters are currently available, unable to estimate when next cluster will be free")
+			}
+
+			// requests already on the waitlist for the same platform go first
+			if !m.hasCapacity(job) || m.waitlistedOn(job.Platform, req.Priority) {
+				klog.Infof("user %q is will have to wait", user)
+				req.Name = ""
+				position := m.addToWaitlist(req, job)
+				if m.launchedClusters() < m.maxClusters {
+					return "", fmt.Errorf("no `%s` clusters are currently available, %s. I'll message you when your cluster starts launching", job.Platform, m.waitlistMessage(position))
 				}
-				return "", fmt.Errorf("no clusters are currently available, next slot available in %d minutes", int(math.Ceil(minutes)))
+				return "", fmt.Errorf("no clusters are currently available, %s. I'll message you when your cluster starts launching", m.waitlistMessage(position))
 			}
 		} else {
 			running := 0
@@ -1267,16 +2184,22 @@ func (m *jobManager) LaunchJobForUser(req *JobRequest) (string, error) {
 				return "", fmt.Errorf("you can't have more than %d running jobs at a time", maxJobsPerUser)
 			}
 		}
+		m.setPhase(job, JobPhaseCreating)
 		m.jobs[job.Name] = job
+		m.userChanged(user)
 		klog.Infof("Job %q starting cluster for %q", job.Name, user)
 		return "", nil
 	}()
+	if preempted != nil {
+		go m.preemptJob(*preempted)
+	}
 	if err != nil || len(msg) > 0 {
 		return msg, err
 	}
 
 	prowJobUrl, err := m.newJob(job)
 	if err != nil {
+		m.updatePhase(job, JobPhaseFailed)
 		return "", fmt.Errorf("the requested job cannot be started: %v", err)
 	}
 
@@ -1294,27 +2217,40 @@ func (m *jobManager) LaunchJobForUser(req *JobRequest) (string, error) {
 	return "", fmt.Errorf("%s<%s|job> started, you will be notified on completion", msg, prowJobUrl)
 }
 
-func (m *jobManager) clusterDetailsForUser(user string) (string, string, error) {
+func (m *jobManager) clusterDetailsForUser(user, clusterName string) (string, string, string, error) {
 	if len(user) == 0 {
-		return "", "", fmt.Errorf("must specify the name of the user who requested this cluster")
+		return "", "", "", fmt.Errorf("must specify the name of the user who requested this cluster")
 	}
 
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	existing, ok := m.requests[user]
-	if !ok || len(existing.Name) == 0 {
-		return "", "", fmt.Errorf("no cluster has been requested by you")
+	existing, err := m.requestForUser(user, clusterName)
+	if err != nil {
+		return "", "", "", err
+	}
+	if existing == nil || len(existing.Name) == 0 {
+		if len(clusterName) > 0 {
+			return "", "", "", fmt.Errorf("no cluster named `%s` has been requested by you", clusterName)
+		}
+		return "", "", "", fmt.Errorf("no cluster has been requested by you")
 	}
 	job, ok := m.jobs[existing.Name]
 	if !ok || len(job.BuildCluster) == 0 {
-		return "", "", fmt.Errorf("unable to determine build cluster for your job")
+		return "", "", "", fmt.Errorf("unable to determine build cluster for your job")
 	}
-	return existing.Name, job.BuildCluster, nil
+	return requestKey(user, existing.ClusterName), existing.Name, job.BuildCluster, nil
 }
 
-func (m *jobManager) TerminateJobForUser(user string) (string, error) {
-	name, cluster, err := m.clusterDetailsForUser(user)
+func (m *jobManager) TerminateJobForUser(user, clusterName string) (string, error) {
+	if m.cancelWaitlistedRequest(user, clusterName) {
+		return "you have been removed from the waitlist", nil
+	}
+	if m.cancelPendingApproval(user, clusterName) {
+		return "your request is no longer waiting for approval", nil
+	}
+
+	key, name, cluster, err := m.clusterDetailsForUser(user, clusterName)
 	if err != nil {
 		return "", err
 	}
@@ -1330,19 +2266,115 @@ func (m *jobManager) TerminateJobForUser(user string) (string, error) {
 	if job, ok := m.jobs[name]; ok {
 		job.Failure = "deletion requested"
 		job.ExpiresAt = time.Now().Add(15 * time.Minute)
-		job.Complete = true
+		m.setPhase(job, JobPhaseTearingDown)
 	}
 
 	// mark the cluster as failed, clear the request, and allow the user to launch again
-	existing, ok := m.requests[user]
+	existing, ok := m.requests[key]
 	if !ok || existing.Name != name {
 		return "", fmt.Errorf("another cluster was launched while trying to stop this cluster")
 	}
-	delete(m.requests, user)
+	delete(m.requests, key)
+	m.userChanged(user)
+	m.startWaitlistedJobs()
 	return "the cluster was flagged for shutdown, you may now launch another", nil
 }
 
-func (m *jobManager) SyncJobForUser(user string) (string, error) {
+// requestApproval asks the approval channel to approve the lifetime of a request. Caller must hold
+// the lock.
+func (m *jobManager) requestApproval(req *JobRequest) (string, error) {
+	key := requestKey(req.User, req.ClusterName)
+	for _, pending := range m.approvals {
+		if requestKey(pending.User, pending.ClusterName) == key {
+			return "", fmt.Errorf("you have already requested %s and it is waiting for approval", clusterDescription(req.ClusterName))
+		}
+	}
+	if len(m.approvalChannel) == 0 {
+		return "", fmt.Errorf("clusters may not run for longer than %s", m.maxAge)
+	}
+	m.approvalCount++
+	id := fmt.Sprintf("a%d", m.approvalCount)
+	m.approvals[id] = req
+	klog.Infof("user %q requested approval %s for a cluster lifetime of %s", key, id, req.Lifetime)
+	m.sendMessage(m.approvalChannel, fmt.Sprintf("<@%s> requests a cluster that runs for %s: `%s`\nReply `approve %s` or `deny %s <reason>`", req.User, req.Lifetime, req.OriginalMessage, id, id),
+		MessageAction{ID: ActionApprove, Label: "Approve", Value: id},
+		MessageAction{ID: ActionDeny, Label: "Deny", Value: id},
+	)
+	return fmt.Sprintf("clusters that run for longer than %s must be approved, I've asked for approval and will message you once your request has been reviewed", m.maxAge), nil
+}
+
+func (m *jobManager) ResolveApproval(channel, approver, id string, approved bool, reason string) (string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if len(m.approvalChannel) == 0 || channel != m.approvalChannel {
+		return "", fmt.Errorf("requests can only be approved or denied in the approval channel")
+	}
+	req, ok := m.approvals[id]
+	if !ok {
+		return "", fmt.Errorf("there is no request `%s` waiting for approval", id)
+	}
+	if approver == req.User {
+		return "", fmt.Errorf("you cannot approve or deny your own request, ask another admin")
+	}
+	delete(m.approvals, id)
+
+	if !approved {
+		klog.Infof("user %q denied approval %s", approver, id)
+		msg := fmt.Sprintf("your request for a cluster that runs for %s was denied by <@%s>", req.Lifetime, approver)
+		if len(reason) > 0 {
+			msg = fmt.Sprintf("%s: %s", msg, reason)
+		}
+		m.sendThreadMessage(req.Channel, req.Thread, msg)
+		return fmt.Sprintf("request `%s` from <@%s> was denied", id, req.User), nil
+	}
+
+	klog.Infof("user %q approved approval %s", approver, id)
+	req.ApprovedBy = approver
+	go func() {
+		msg, err := m.LaunchJobForUser(req)
+		if err != nil {
+			msg = err.Error()
+		}
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		m.sendThreadMessage(req.Channel, req.Thread, fmt.Sprintf("your request for a cluster that runs for %s was approved by <@%s>, %s", req.Lifetime, approver, msg))
+	}()
+	return fmt.Sprintf("request `%s` from <@%s> was approved", id, req.User), nil
+}
+
+// cancelPendingApproval forgets the request of a user that is still waiting for approval.
+func (m *jobManager) cancelPendingApproval(user, clusterName string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	key := requestKey(user, clusterName)
+	for id, pending := range m.approvals {
+		if requestKey(pending.User, pending.ClusterName) == key {
+			klog.Infof("user %q withdrew approval %s", key, id)
+			delete(m.approvals, id)
+			return true
+		}
+	}
+	return false
+}
+
+// cancelWaitlistedRequest forgets the request of a user that is still on the waitlist.
+func (m *jobManager) cancelWaitlistedRequest(user, clusterName string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	existing, _ := m.requestForUser(user, clusterName)
+	if existing == nil || !m.removeFromWaitlist(existing) {
+		return false
+	}
+	key := requestKey(user, existing.ClusterName)
+	klog.Infof("user %q left the waitlist", key)
+	delete(m.requests, key)
+	return true
+}
+
+func (m *jobManager) SyncJobForUser(user, clusterName string) (string, error) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
@@ -1350,8 +2382,14 @@ func (m *jobManager) SyncJobForUser(user string) (string, error) {
 		return "", fmt.Errorf("must specify the name of the user who requested this cluster")
 	}
 
-	existing, ok := m.requests[user]
-	if !ok || len(existing.Name) == 0 {
+	existing, err := m.requestForUser(user, clusterName)
+	if err != nil {
+		return "", err
+	}
+	if existing == nil || len(existing.Name) == 0 {
+		if len(clusterName) > 0 {
+			return "", fmt.Errorf("no cluster named `%s` has been requested by you", clusterName)
+		}
 		return "", fmt.Errorf("no cluster has been requested by you")
 	}
 	job, ok := m.jobs[existing.Name]
@@ -1360,13 +2398,21 @@ func (m *jobManager) SyncJobForUser(user string) (string, error) {
 	}
 
 	var msg string
-	switch {
-	case len(job.Failure) == 0 && len(job.Credentials) == 0:
-		return "cluster is still being loaded, please be patient", nil
-	case len(job.Failure) > 0:
-		msg = fmt.Sprintf("cluster had previously been marked as failed, checking again: %s", job.Failure)
-	case len(job.Credentials) > 0:
+	switch job.Phase {
+	case JobPhaseReady:
 		msg = fmt.Sprintf("cluster had previously been marked as successful, checking again")
+	case JobPhaseFailed:
+		// only a launch that failed while its prow job is still running can recover
+		if job.State != prowapiv1.PendingState {
+			return "", fmt.Errorf("cluster failed and has been shut down, launch a new one: %s", job.Failure)
+		}
+		msg = fmt.Sprintf("cluster had previously been marked as failed, checking again: %s", job.Failure)
+		m.setPhase(job, JobPhaseCreating)
+		job.Failure = ""
+	case JobPhaseTearingDown, JobPhaseSucceeded, JobPhaseExpired:
+		return "", fmt.Errorf("cluster has been shut down, launch a new one")
+	default:
+		return "cluster is still being loaded, please be patient", nil
 	}
 
 	copied := *job
@@ -1377,6 +2423,406 @@ func (m *jobManager) SyncJobForUser(user string) (string, error) {
 	return msg, nil
 }
 
+func (m *jobManager) ExtendJobForUser(user, clusterName string, duration time.Duration) (string, error) {
+	if !m.extendEnabled {
+		return "", fmt.Errorf("extending clusters is not enabled")
+	}
+	if duration <= 0 {
+		return "", fmt.Errorf("the cluster lifetime can only be extended by a positive duration")
+	}
+
+	m.lock.Lock()
+	existing, err := m.requestForUser(user, clusterName)
+	if err != nil {
+		m.lock.Unlock()
+		return "", err
+	}
+	if existing == nil || len(existing.Name) == 0 {
+		m.lock.Unlock()
+		return "", fmt.Errorf("you don't have a running cluster to extend")
+	}
+	job, ok := m.jobs[existing.Name]
+	if !ok || job.Phase.Stopped() {
+		m.lock.Unlock()
+		return "", fmt.Errorf("your cluster is no longer running and cannot be extended")
+	}
+	if job.Phase != JobPhaseReady {
+		m.lock.Unlock()
+		return "", fmt.Errorf("your cluster is still starting, you can extend it once it is ready")
+	}
+	if job.TargetType != "steps" {
+		m.lock.Unlock()
+		return "", fmt.Errorf("clusters launched from legacy templates cannot be extended")
+	}
+	expiresAt := job.ExpiresAt.Add(duration)
+	if maxLifetime := m.maxLifetimeFor(job); expiresAt.Sub(job.RequestedAt) > maxLifetime {
+		remaining := (maxLifetime - job.ExpiresAt.Sub(job.RequestedAt)).Truncate(time.Minute)
+		m.lock.Unlock()
+		if remaining < time.Minute {
+			return "", fmt.Errorf("clusters may not run for longer than %s and yours cannot be extended any further", maxLifetime)
+		}
+		return "", fmt.Errorf("clusters may not run for longer than %s, you may extend yours by at most %s", maxLifetime, remaining)
+	}
+	copied := *job
+	m.lock.Unlock()
+
+	if err := m.extendJob(&copied, expiresAt); err != nil {
+		klog.Errorf("Job %q could not be extended: %v", copied.Name, err)
+		return "", fmt.Errorf("unable to extend your cluster: %v", err)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if job, ok := m.jobs[copied.Name]; ok {
+		job.ExpiresAt = expiresAt
+		job.ExpiryWarning = 0
+	}
+	m.userChanged(user)
+	klog.Infof("user %q extended job %q until %s", user, copied.Name, expiresAt.Format(time.RFC3339))
+	return fmt.Sprintf("your cluster will now be shut down automatically in ~%d minutes", int(time.Until(expiresAt)/time.Minute)), nil
+}
+
+// checkInIdleJobs asks the owners of clusters that have been up for a while whether they still use
+// them, and shuts down the clusters of owners who do not answer in time so the slot can be used by
+// someone else. Clusters that were approved for a longer lifetime or reserved are not checked.
+func (m *jobManager) checkInIdleJobs() {
+	now := time.Now()
+	m.lock.Lock()
+	var checkIns, reclaims []Job
+	for _, job := range m.jobs {
+		if job.Mode != JobTypeLaunch && job.Mode != JobTypeWorkflowLaunch {
+			continue
+		}
+		if job.Phase != JobPhaseReady || job.Kept {
+			continue
+		}
+		if len(job.ApprovedBy) > 0 || len(job.Reservation) > 0 {
+			continue
+		}
+		switch {
+		case job.CheckInSentAt.IsZero() && now.Sub(job.RequestedAt) >= m.idleCheckIn:
+			job.CheckInSentAt = now
+			checkIns = append(checkIns, *job)
+		case !job.CheckInSentAt.IsZero() && now.Sub(job.CheckInSentAt) >= m.idleTimeout:
+			job.Failure = "deletion requested"
+			job.StopReason = "reclaimed after no answer to the idle check-in"
+			job.ExpiresAt = now.Add(15 * time.Minute)
+			m.setPhase(job, JobPhaseTearingDown)
+			key := requestKey(job.RequestedBy, job.ClusterName)
+			if existing, ok := m.requests[key]; ok && existing.Name == job.Name {
+				delete(m.requests, key)
+			}
+			reclaims = append(reclaims, *job)
+		}
+	}
+	if len(reclaims) > 0 {
+		m.startWaitlistedJobs()
+	}
+	m.lock.Unlock()
+
+	for _, job := range checkIns {
+		if err := m.annotateJob(job.Name, map[string]string{annotationCheckIn: strconv.FormatInt(job.CheckInSentAt.Unix(), 10)}); err != nil {
+			klog.Infof("error: Job %q unable to record idle check-in: %v", job.Name, err)
+		}
+		cluster, suffix := "your cluster", ""
+		if len(job.ClusterName) > 0 {
+			cluster, suffix = fmt.Sprintf("your cluster `%s`", job.ClusterName), " "+job.ClusterName
+		}
+		m.lock.Lock()
+		m.sendMessage(job.RequestedBy, fmt.Sprintf("Are you still using %s? Reply `keep%s` within %d minutes to keep it running, or `done%s` to release it for someone else. I'll shut it down if I don't hear from you.", cluster, suffix, int(m.idleTimeout/time.Minute), suffix),
+			MessageAction{ID: ActionKeep, Label: "Keep", Value: jobActionValue(&job)},
+			MessageAction{ID: ActionDone, Label: "Release", Value: jobActionValue(&job)},
+		)
+		m.lock.Unlock()
+	}
+
+	for _, job := range reclaims {
+		klog.Infof("Job %q is reclaimed after no answer to the idle check-in", job.Name)
+		if err := m.stopJob(job.Name, job.BuildCluster); err != nil {
+			klog.Errorf("Job %q could not be reclaimed: %v", job.Name, err)
+		}
+		if err := m.annotateJob(job.Name, map[string]string{annotationStopReason: job.StopReason}); err != nil {
+			klog.Infof("error: Job %q unable to record stop reason: %v", job.Name, err)
+		}
+		cluster := "your cluster"
+		if len(job.ClusterName) > 0 {
+			cluster = fmt.Sprintf("your cluster `%s`", job.ClusterName)
+		}
+		m.lock.Lock()
+		m.sendMessage(job.RequestedBy, fmt.Sprintf("%s was shut down because I didn't hear back from you. You may launch another at any time.", cluster))
+		m.lock.Unlock()
+	}
+}
+
+func (m *jobManager) KeepJobForUser(user, clusterName string) (string, error) {
+	m.lock.Lock()
+	existing, err := m.requestForUser(user, clusterName)
+	if err != nil {
+		m.lock.Unlock()
+		return "", err
+	}
+	if existing == nil || len(existing.Name) == 0 {
+		m.lock.Unlock()
+		return "", fmt.Errorf("you don't have a running cluster")
+	}
+	job, ok := m.jobs[existing.Name]
+	if !ok || job.Phase.Stopped() {
+		m.lock.Unlock()
+		return "", fmt.Errorf("your cluster is no longer running")
+	}
+	job.Kept = true
+	name := job.Name
+	m.lock.Unlock()
+
+	if err := m.annotateJob(name, map[string]string{annotationCheckIn: "kept"}); err != nil {
+		klog.Infof("error: Job %q unable to record idle check-in answer: %v", name, err)
+	}
+	return "thanks, I'll leave your cluster running until it expires", nil
+}
+
+// warnExpiringJobs notifies the owners of running clusters that are approaching their expiration
+// time. The warnings already sent are recorded on the prow job so they are not repeated after a
+// restart.
+func (m *jobManager) warnExpiringJobs() {
+	now := time.Now()
+	m.lock.Lock()
+	var warnings []Job
+	for _, job := range m.jobs {
+		if job.Mode != JobTypeLaunch && job.Mode != JobTypeWorkflowLaunch {
+			continue
+		}
+		if job.Phase.Stopped() || len(job.RequestedBy) == 0 {
+			continue
+		}
+		remaining := job.ExpiresAt.Sub(now)
+		if remaining <= 0 {
+			continue
+		}
+		threshold := expiryWarningThreshold(m.expiryWarnings, remaining)
+		if threshold == 0 || (job.ExpiryWarning > 0 && job.ExpiryWarning <= threshold) {
+			continue
+		}
+		job.ExpiryWarning = threshold
+		warnings = append(warnings, *job)
+	}
+	m.lock.Unlock()
+
+	for _, job := range warnings {
+		if err := m.recordExpiryWarning(job.Name, job.ExpiryWarning); err != nil {
+			klog.Infof("error: Job %q unable to record expiry warning: %v", job.Name, err)
+		}
+		m.lock.Lock()
+		msg, actions := m.expiryWarningMessage(&job, now)
+		m.sendMessage(job.RequestedBy, msg, actions...)
+		m.lock.Unlock()
+	}
+}
+
+// stopExpiredJobs shuts down clusters that have reached their expiration. Clusters that may be
+// extended are launched for their maximum lifetime, so the bot ends them when the lifetime they
+// have been given is over.
+func (m *jobManager) stopExpiredJobs() {
+	// clusters are stopped up to a minute early so that a sync does not forget them first
+	deadline := time.Now().Add(time.Minute)
+	m.lock.Lock()
+	var expired []Job
+	for _, job := range m.jobs {
+		if job.Mode != JobTypeLaunch && job.Mode != JobTypeWorkflowLaunch {
+			continue
+		}
+		if job.Phase.Stopped() || job.ExpiresAt.After(deadline) {
+			continue
+		}
+		expired = append(expired, *job)
+	}
+	m.lock.Unlock()
+
+	for _, job := range expired {
+		klog.Infof("Job %q has expired and will be shut down", job.Name)
+		if err := m.stopJob(job.Name, job.BuildCluster); err != nil {
+			klog.Errorf("Job %q could not be shut down at its expiration: %v", job.Name, err)
+			continue
+		}
+		cluster := "your cluster"
+		if len(job.ClusterName) > 0 {
+			cluster = fmt.Sprintf("your cluster `%s`", job.ClusterName)
+		}
+		m.lock.Lock()
+		if tracked, ok := m.jobs[job.Name]; ok {
+			tracked.ExpiresAt = time.Now().Add(15 * time.Minute)
+			m.setPhase(tracked, JobPhaseExpired)
+		}
+		key := requestKey(job.RequestedBy, job.ClusterName)
+		if existing, ok := m.requests[key]; ok && existing.Name == job.Name {
+			delete(m.requests, key)
+		}
+		m.sendMessage(job.RequestedBy, fmt.Sprintf("%s has reached the end of its lifetime and is being shut down. You may launch another at any time.", cluster))
+		m.startWaitlistedJobs()
+		m.lock.Unlock()
+	}
+}
+
+// expiryWarningThreshold returns the smallest warning threshold that the remaining time falls
+// within, or zero if no warning is due yet.
+func expiryWarningThreshold(thresholds []time.Duration, remaining time.Duration) time.Duration {
+	var threshold time.Duration
+	for _, t := range thresholds {
+		if remaining <= t && (threshold == 0 || t < threshold) {
+			threshold = t
+		}
+	}
+	return threshold
+}
+
+// expiryWarningMessage describes how long the cluster has left and what the owner can do about it.
+func (m *jobManager) expiryWarningMessage(job *Job, now time.Time) (string, []MessageAction) {
+	cluster, suffix := "your cluster", ""
+	if len(job.ClusterName) > 0 {
+		cluster, suffix = fmt.Sprintf("your cluster `%s`", job.ClusterName), " "+job.ClusterName
+	}
+	var actions []MessageAction
+	msg := fmt.Sprintf("%s will be shut down in %d minutes.", cluster, int(job.ExpiresAt.Sub(now).Round(time.Minute)/time.Minute))
+	if m.extendEnabled && job.TargetType == "steps" {
+		if extension := (m.maxLifetimeFor(job) - job.ExpiresAt.Sub(job.RequestedAt)).Truncate(time.Minute); extension >= time.Minute {
+			msg += fmt.Sprintf(" Send `extend 1h%s` to keep it up for longer (at most %s more),", suffix, extension)
+			actions = append(actions, MessageAction{ID: ActionExtend, Label: "Extend 1h", Value: jobActionValue(job)})
+		} else {
+			msg += " It has reached the maximum lifetime and cannot be extended,"
+		}
+	}
+	actions = append(actions, MessageAction{ID: ActionDone, Label: "Done", Value: jobActionValue(job)})
+	return msg + fmt.Sprintf(" or `done%s` if you no longer need it.", suffix), actions
+}
+
+// usageForUser returns the cluster time the user has consumed within the quota window and the
+// number of clusters that contributed to it. Clusters launched since the last sync are included.
+// Caller must hold the lock.
+func (m *jobManager) usageForUser(user string, now time.Time) (time.Duration, int) {
+	windowStart := now.Add(-m.quotaWindow)
+	var total time.Duration
+	var clusters int
+	add := func(start, end time.Time) {
+		if end.IsZero() || end.After(now) {
+			end = now
+		}
+		if start.Before(windowStart) {
+			start = windowStart
+		}
+		if end.After(start) {
+			total += end.Sub(start)
+			clusters++
+		}
+	}
+	for _, u := range m.usage {
+		if u.user == user {
+			add(u.start, u.end)
+		}
+	}
+	// completed clusters are remembered after their prow jobs are garbage collected
+	for _, record := range m.history {
+		if _, ok := m.usage[record.Name]; ok || record.User != user {
+			continue
+		}
+		if record.Mode != JobTypeLaunch && record.Mode != JobTypeWorkflowLaunch {
+			continue
+		}
+		add(record.StartedAt, record.CompletedAt)
+	}
+	for _, job := range m.jobs {
+		if _, ok := m.usage[job.Name]; ok || job.RequestedBy != user {
+			continue
+		}
+		if job.Mode != JobTypeLaunch && job.Mode != JobTypeWorkflowLaunch {
+			continue
+		}
+		add(job.RequestedAt, time.Time{})
+	}
+	return total, clusters
+}
+
+// quotaWindowDescription describes the quota window in days where possible.
+func (m *jobManager) quotaWindowDescription() string {
+	if m.quotaWindow%(24*time.Hour) == 0 {
+		if days := int(m.quotaWindow / (24 * time.Hour)); days != 1 {
+			return fmt.Sprintf("%d days", days)
+		}
+		return "day"
+	}
+	return m.quotaWindow.String()
+}
+
+func (m *jobManager) QuotaForUser(user string) string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	used, clusters := m.usageForUser(user, time.Now())
+	if m.quota <= 0 {
+		return fmt.Sprintf("you have used %.1f cluster-hours across %d clusters in the last %s, there is no limit on usage", used.Hours(), clusters, m.quotaWindowDescription())
+	}
+	return fmt.Sprintf("you have used %.1f of your %.0f cluster-hours across %d clusters in the last %s", used.Hours(), m.quota.Hours(), clusters, m.quotaWindowDescription())
+}
+
+// maxHistoryListed is how many completed jobs the history command lists.
+const maxHistoryListed = 10
+
+// HistoryForUser lists the most recent jobs of a user that have completed.
+func (m *jobManager) HistoryForUser(user string) string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var records []JobRecord
+	for _, record := range m.history {
+		if record.User == user {
+			records = append(records, record)
+		}
+	}
+	if len(records) == 0 {
+		return "you have no completed jobs"
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CompletedAt.After(records[j].CompletedAt)
+	})
+	if len(records) > maxHistoryListed {
+		records = records[:maxHistoryListed]
+	}
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "Your %d most recent jobs:\n", len(records))
+	for _, record := range records {
+		outcome := "succeeded"
+		if len(record.Failure) > 0 {
+			outcome = "failed"
+		}
+		description := record.Mode
+		if len(record.Inputs) > 0 {
+			description += " " + record.Inputs
+		}
+		if len(record.Platform) > 0 {
+			description += " on " + record.Platform
+		}
+		if len(record.ClusterName) > 0 {
+			description += fmt.Sprintf(" (%s)", record.ClusterName)
+		}
+		fmt.Fprintf(buf, "• %s - <%s|%s> after %s, %s\n", description, record.URL, outcome, record.CompletedAt.Sub(record.StartedAt).Truncate(time.Minute), record.CompletedAt.UTC().Format("Jan 2 15:04 UTC"))
+	}
+	return buf.String()
+}
+
+func (m *jobManager) SettingsForUser(user string) UserSettings {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.settings[user]
+}
+
+func (m *jobManager) UpdateSettingsForUser(user string, settings UserSettings) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if settings == (UserSettings{}) {
+		delete(m.settings, user)
+		return
+	}
+	m.settings[user] = settings
+}
+
 func (m *jobManager) jobIsComplete(job *Job) bool {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -1384,10 +2830,10 @@ func (m *jobManager) jobIsComplete(job *Job) bool {
 	if !ok {
 		return false
 	}
-	if current.IsComplete() {
+	if current.Phase.Stopped() {
 		job.State = current.State
 		job.URL = current.URL
-		job.Complete = current.Complete
+		job.Phase = current.Phase
 		return true
 	}
 	return false
@@ -1406,8 +2852,12 @@ func (m *jobManager) handleJobStartup(job Job, source string) {
 		} else {
 			klog.Errorf("Job %q failed to launch (%s): %v", job.Name, source, err)
 			job.Failure = err.Error()
+			m.updatePhase(&job, JobPhaseFailed)
 		}
 	}
+	if job.Phase.Stopped() {
+		m.reportProgress(&job, job.Progress)
+	}
 	m.finishedJob(job)
 }
 
@@ -1429,13 +2879,32 @@ func (m *jobManager) finishedJob(job Job) {
 	if len(job.RequestedChannel) > 0 && len(job.RequestedBy) > 0 {
 		klog.Infof("Job %q complete, notify %q", job.Name, job.RequestedBy)
 		if m.notifierFn != nil {
-			go m.notifierFn(job)
+			notify, notified := m.notifierFn, job
+			go func() {
+				// clear the channel first so a replica that takes over does not notify again
+				m.clearNotificationAnnotations(&notified, false, 0)
+				notify(notified)
+			}()
 		}
 	}
 
 	// ensure we send no further notifications
 	job.RequestedChannel = ""
+	// the worker may have missed changes to the phase of the tracked job
+	next := job.Phase
+	if len(job.Failure) > 0 && !next.Stopped() {
+		next = JobPhaseFailed
+	}
+	if tracked, ok := m.jobs[job.Name]; ok {
+		job.Phase = tracked.Phase
+	}
+	if job.Phase != next && job.Phase.CanTransitionTo(next) {
+		m.setPhase(&job, next)
+	}
 	m.jobs[job.Name] = &job
+	m.userChanged(job.RequestedBy)
+
+	m.startWaitlistedJobs()
 }
 
 func (m *jobManager) tryJob(name string) bool {
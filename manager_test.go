@@ -0,0 +1,348 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRemoveFromWaitlist(t *testing.T) {
+	testCases := []struct {
+		name    string
+		waiting int
+		user    string
+		removed bool
+		// notified are the users that are told their new position
+		notified []string
+	}{
+		{name: "empty waitlist", user: "U0"},
+		{name: "user is not waiting", waiting: 2, user: "U5"},
+		{name: "first user", waiting: 3, user: "U0", removed: true, notified: []string{"U1", "U2"}},
+		{name: "middle user", waiting: 3, user: "U1", removed: true, notified: []string{"U2"}},
+		{name: "last user", waiting: 3, user: "U2", removed: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			messages := make(chan string, 10)
+			m := &jobManager{
+				jobs: make(map[string]*Job),
+				messageFn: func(channel, thread, message string, actions ...MessageAction) {
+					messages <- channel
+				},
+			}
+			var expected []string
+			for i := 0; i < tc.waiting; i++ {
+				user := fmt.Sprintf("U%d", i)
+				req := &JobRequest{User: user, Channel: user}
+				m.waitlist = append(m.waitlist, waitlistEntry{request: req, job: &Job{}})
+				if user != tc.user {
+					expected = append(expected, user)
+				}
+			}
+			req := &JobRequest{User: tc.user}
+			for _, entry := range m.waitlist {
+				if entry.request.User == tc.user {
+					req = entry.request
+				}
+			}
+			if removed := m.removeFromWaitlist(req); removed != tc.removed {
+				t.Errorf("expected removed to be %t, got %t", tc.removed, removed)
+			}
+			var waiting []string
+			for _, entry := range m.waitlist {
+				waiting = append(waiting, entry.request.User)
+			}
+			if strings.Join(waiting, ",") != strings.Join(expected, ",") {
+				t.Errorf("expected waitlist %v, got %v", expected, waiting)
+			}
+			for i, entry := range m.waitlist {
+				if position := m.waitlistPosition(entry.request); position != i+1 {
+					t.Errorf("expected %s at position %d, got %d", entry.request.User, i+1, position)
+				}
+			}
+
+			var notified []string
+			for range tc.notified {
+				select {
+				case channel := <-messages:
+					notified = append(notified, channel)
+				case <-time.After(time.Second):
+				}
+			}
+			sort.Strings(notified)
+			if strings.Join(notified, ",") != strings.Join(tc.notified, ",") {
+				t.Errorf("expected %v to be notified, got %v", tc.notified, notified)
+			}
+			select {
+			case channel := <-messages:
+				t.Errorf("unexpected message to %s", channel)
+			case <-time.After(10 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestAddToWaitlist(t *testing.T) {
+	testCases := []struct {
+		name     string
+		waiting  []Priority
+		priority Priority
+		position int
+		// notified are the users that are told their new position
+		notified []string
+	}{
+		{name: "empty waitlist", priority: PriorityNormal, position: 1},
+		{name: "normal request goes last", waiting: []Priority{PriorityHigh, PriorityNormal}, priority: PriorityNormal, position: 3},
+		{name: "priority request goes ahead of normal requests", waiting: []Priority{PriorityHigh, PriorityNormal, PriorityNormal}, priority: PriorityHigh, position: 2, notified: []string{"U1", "U2"}},
+		{name: "priority request goes behind earlier priority requests", waiting: []Priority{PriorityHigh, PriorityHigh}, priority: PriorityHigh, position: 3},
+		{name: "priority request goes first", waiting: []Priority{PriorityNormal}, priority: PriorityHigh, position: 1, notified: []string{"U0"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			messages := make(chan string, 10)
+			m := &jobManager{
+				jobs: make(map[string]*Job),
+				messageFn: func(channel, thread, message string, actions ...MessageAction) {
+					messages <- channel
+				},
+			}
+			for i, priority := range tc.waiting {
+				user := fmt.Sprintf("U%d", i)
+				m.waitlist = append(m.waitlist, waitlistEntry{
+					request: &JobRequest{User: user, Channel: user, Priority: priority},
+					job:     &Job{Name: fmt.Sprintf("waiting-%d", i), Phase: JobPhaseQueued},
+				})
+			}
+			req := &JobRequest{User: "new", Channel: "new", Priority: tc.priority}
+			job := &Job{Name: "new"}
+			if position := m.addToWaitlist(req, job); position != tc.position {
+				t.Errorf("expected position %d, got %d", tc.position, position)
+			}
+			if len(m.waitlist) != len(tc.waiting)+1 || m.waitlist[tc.position-1].request != req {
+				t.Fatalf("the request is not at position %d", tc.position)
+			}
+			if job.Phase != JobPhaseQueued {
+				t.Errorf("expected the job to be queued, got %s", job.Phase)
+			}
+			for i := 1; i < len(m.waitlist); i++ {
+				if m.waitlist[i-1].request.Priority < m.waitlist[i].request.Priority {
+					t.Errorf("a normal request is ahead of a priority request at position %d", i)
+				}
+			}
+
+			var notified []string
+			for range tc.notified {
+				select {
+				case channel := <-messages:
+					notified = append(notified, channel)
+				case <-time.After(time.Second):
+				}
+			}
+			sort.Strings(notified)
+			if strings.Join(notified, ",") != strings.Join(tc.notified, ",") {
+				t.Errorf("expected %v to be notified, got %v", tc.notified, notified)
+			}
+			select {
+			case channel := <-messages:
+				t.Errorf("unexpected message to %s", channel)
+			case <-time.After(10 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestUsageForUser(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+	testCases := []struct {
+		name     string
+		usage    map[string]clusterUsage
+		history  []JobRecord
+		jobs     []*Job
+		expected time.Duration
+		clusters int
+	}{
+		{
+			name:     "running cluster counts until now",
+			usage:    map[string]clusterUsage{"a": {user: "U1", start: ago(3 * time.Hour)}},
+			expected: 3 * time.Hour,
+			clusters: 1,
+		},
+		{
+			name: "completed clusters count for as long as they ran",
+			usage: map[string]clusterUsage{
+				"a": {user: "U1", start: ago(10 * time.Hour), end: ago(8 * time.Hour)},
+				"b": {user: "U1", start: ago(5 * time.Hour), end: ago(4 * time.Hour)},
+			},
+			expected: 3 * time.Hour,
+			clusters: 2,
+		},
+		{
+			name: "only the part within the window counts",
+			usage: map[string]clusterUsage{
+				"a": {user: "U1", start: ago(25 * time.Hour), end: ago(22 * time.Hour)},
+				"b": {user: "U1", start: ago(30 * time.Hour), end: ago(26 * time.Hour)},
+			},
+			expected: 2 * time.Hour,
+			clusters: 1,
+		},
+		{
+			name:  "clusters of other users do not count",
+			usage: map[string]clusterUsage{"a": {user: "U2", start: ago(3 * time.Hour)}},
+		},
+		{
+			name:  "history counts clusters whose prow jobs are gone once",
+			usage: map[string]clusterUsage{"a": {user: "U1", start: ago(3 * time.Hour), end: ago(2 * time.Hour)}},
+			history: []JobRecord{
+				{Name: "a", User: "U1", Mode: JobTypeLaunch, StartedAt: ago(3 * time.Hour), CompletedAt: ago(2 * time.Hour)},
+				{Name: "b", User: "U1", Mode: JobTypeWorkflowLaunch, StartedAt: ago(6 * time.Hour), CompletedAt: ago(4 * time.Hour)},
+				{Name: "c", User: "U1", Mode: JobTypeTest, StartedAt: ago(6 * time.Hour), CompletedAt: ago(4 * time.Hour)},
+				{Name: "d", User: "U2", Mode: JobTypeLaunch, StartedAt: ago(6 * time.Hour), CompletedAt: ago(4 * time.Hour)},
+			},
+			expected: 3 * time.Hour,
+			clusters: 2,
+		},
+		{
+			name:  "clusters launched since the last sync count",
+			usage: map[string]clusterUsage{"a": {user: "U1", start: ago(2 * time.Hour)}},
+			jobs: []*Job{
+				{Name: "a", RequestedBy: "U1", Mode: JobTypeLaunch, RequestedAt: ago(2 * time.Hour)},
+				{Name: "b", RequestedBy: "U1", Mode: JobTypeLaunch, RequestedAt: ago(30 * time.Minute)},
+				{Name: "c", RequestedBy: "U1", Mode: JobTypeBuild, RequestedAt: ago(30 * time.Minute)},
+			},
+			expected: 150 * time.Minute,
+			clusters: 2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &jobManager{
+				quotaWindow: 24 * time.Hour,
+				usage:       tc.usage,
+				history:     tc.history,
+				jobs:        make(map[string]*Job),
+			}
+			for _, job := range tc.jobs {
+				m.jobs[job.Name] = job
+			}
+			used, clusters := m.usageForUser("U1", now)
+			if used != tc.expected || clusters != tc.clusters {
+				t.Errorf("expected %s used by %d clusters, got %s used by %d clusters", tc.expected, tc.clusters, used, clusters)
+			}
+		})
+	}
+}
+
+func TestPreemptionCandidate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cluster := func(name, platform, architecture string, age time.Duration) *Job {
+		return &Job{
+			Name:         name,
+			Mode:         JobTypeLaunch,
+			Phase:        JobPhaseReady,
+			Platform:     platform,
+			Architecture: architecture,
+			RequestedAt:  now.Add(-age),
+		}
+	}
+	testCases := []struct {
+		name         string
+		jobs         []*Job
+		maxClusters  int
+		capacity     map[string]PlatformCapacity
+		reservations []*Reservation
+		disabled     bool
+		job          *Job
+		expected     string
+	}{
+		{
+			name:        "oldest cluster when every slot is taken",
+			jobs:        []*Job{cluster("a", "aws", "amd64", 3*time.Hour), cluster("b", "gcp", "amd64", 4*time.Hour)},
+			maxClusters: 2,
+			job:         cluster("new", "aws", "amd64", 0),
+			expected:    "b",
+		},
+		{
+			name:        "preemption is disabled",
+			jobs:        []*Job{cluster("a", "aws", "amd64", 3*time.Hour)},
+			maxClusters: 1,
+			disabled:    true,
+			job:         cluster("new", "aws", "amd64", 0),
+		},
+		{
+			name:        "clusters within the grace period are kept",
+			jobs:        []*Job{cluster("a", "aws", "amd64", 30*time.Minute)},
+			maxClusters: 1,
+			job:         cluster("new", "aws", "amd64", 0),
+		},
+		{
+			name: "priority and approved clusters are kept",
+			jobs: func() []*Job {
+				priority, approved := cluster("a", "aws", "amd64", 3*time.Hour), cluster("b", "aws", "amd64", 5*time.Hour)
+				priority.Priority = PriorityHigh
+				approved.ApprovedBy = "U045EF6GH"
+				return []*Job{priority, approved, cluster("c", "aws", "amd64", 2*time.Hour)}
+			}(),
+			maxClusters: 3,
+			job:         cluster("new", "aws", "amd64", 0),
+			expected:    "c",
+		},
+		{
+			name:        "a full platform frees a slot on the same platform",
+			jobs:        []*Job{cluster("a", "gcp", "amd64", 5*time.Hour), cluster("b", "aws", "amd64", 2*time.Hour)},
+			maxClusters: 10,
+			capacity:    map[string]PlatformCapacity{"aws": {Limit: 1}},
+			job:         cluster("new", "aws", "amd64", 0),
+			expected:    "b",
+		},
+		{
+			name:        "a full architecture frees a slot of the same architecture",
+			jobs:        []*Job{cluster("a", "aws", "amd64", 5*time.Hour), cluster("b", "aws", "arm64", 2*time.Hour)},
+			maxClusters: 10,
+			capacity:    map[string]PlatformCapacity{"aws": {Limit: 5, Architectures: map[string]int{"arm64": 1}}},
+			job:         cluster("new", "aws", "arm64", 0),
+			expected:    "b",
+		},
+		{
+			name: "clusters of another architecture do not free a slot",
+			jobs: func() []*Job {
+				priority := cluster("b", "aws", "arm64", 2*time.Hour)
+				priority.Priority = PriorityHigh
+				return []*Job{cluster("a", "aws", "amd64", 5*time.Hour), priority}
+			}(),
+			maxClusters: 10,
+			capacity:    map[string]PlatformCapacity{"aws": {Limit: 5, Architectures: map[string]int{"arm64": 1}}},
+			job:         cluster("new", "aws", "arm64", 0),
+		},
+		{
+			name:         "only held slots are missing",
+			jobs:         []*Job{cluster("a", "aws", "amd64", 5*time.Hour)},
+			maxClusters:  2,
+			reservations: []*Reservation{{ID: "r1", Count: 1, Platform: "aws", Start: now.Add(-time.Hour), Duration: 3 * time.Hour}},
+			job:          cluster("new", "aws", "amd64", 0),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &jobManager{
+				jobs:         make(map[string]*Job),
+				maxClusters:  tc.maxClusters,
+				priority:     &PriorityConfig{Preempt: !tc.disabled, GracePeriod: time.Hour},
+				capacity:     &CapacityConfig{Platforms: tc.capacity},
+				reservations: tc.reservations,
+			}
+			for _, job := range tc.jobs {
+				m.jobs[job.Name] = job
+			}
+			var name string
+			if candidate := m.preemptionCandidate(tc.job, now); candidate != nil {
+				name = candidate.Name
+			}
+			if name != tc.expected {
+				t.Errorf("expected candidate %q, got %q", tc.expected, name)
+			}
+		})
+	}
+}
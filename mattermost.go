@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"k8s.io/klog"
+)
+
+// mattermostFrontend connects the bot to a Mattermost server with the access token of a bot
+// account. Commands are received over the websocket API from direct messages and from posts that
+// mention the bot, and answered through the REST API.
+type mattermostFrontend struct {
+	url    string
+	token  string
+	client *http.Client
+
+	bot         *Bot
+	botUserID   string
+	botUsername string
+
+	lock sync.Mutex
+	// channelTypes caches the type of channels by ID, D for direct messages
+	channelTypes map[string]string
+	// usernames caches the usernames of users by ID
+	usernames map[string]string
+}
+
+func NewMattermostFrontend(url, token string) *mattermostFrontend {
+	return &mattermostFrontend{
+		url:          strings.TrimSuffix(url, "/"),
+		token:        token,
+		client:       &http.Client{Timeout: 30 * time.Second},
+		channelTypes: make(map[string]string),
+		usernames:    make(map[string]string),
+	}
+}
+
+// mattermostPost is a message in a Mattermost channel.
+type mattermostPost struct {
+	ID        string   `json:"id,omitempty"`
+	UserID    string   `json:"user_id,omitempty"`
+	ChannelID string   `json:"channel_id"`
+	RootID    string   `json:"root_id,omitempty"`
+	Message   string   `json:"message"`
+	Type      string   `json:"type,omitempty"`
+	FileIDs   []string `json:"file_ids,omitempty"`
+}
+
+// mattermostEvent is an event received over the websocket API.
+type mattermostEvent struct {
+	Event string `json:"event"`
+	Data  struct {
+		ChannelType string `json:"channel_type"`
+		// Post and Mentions are JSON documents encoded as strings
+		Post     string `json:"post"`
+		Mentions string `json:"mentions"`
+	} `json:"data"`
+}
+
+// Listen receives posts over the websocket API, reconnecting whenever the connection is lost.
+func (f *mattermostFrontend) Listen(bot *Bot, manager JobManager) error {
+	f.bot = bot
+	var me struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	}
+	if err := f.do(http.MethodGet, "/users/me", nil, &me); err != nil {
+		return fmt.Errorf("unable to identify the bot user: %v", err)
+	}
+	f.botUserID, f.botUsername = me.ID, me.Username
+
+	klog.Infof("ci-chat-bot up and listening to mattermost at %s as @%s", f.url, f.botUsername)
+	for {
+		if err := f.runWebsocket(); err != nil {
+			klog.Warningf("mattermost connection lost: %v", err)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func (f *mattermostFrontend) runWebsocket() error {
+	wsURL := "ws" + strings.TrimPrefix(f.url, "http") + "/api/v4/websocket"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Authorization": []string{"Bearer " + f.token}})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for {
+		var event mattermostEvent
+		if err := conn.ReadJSON(&event); err != nil {
+			return err
+		}
+		if event.Event != "posted" {
+			continue
+		}
+		go f.handlePosted(event)
+	}
+}
+
+// handlePosted passes a post to the bot if it is a direct message or mentions the bot. Commands
+// sent in a channel are answered in a thread on the post.
+func (f *mattermostFrontend) handlePosted(event mattermostEvent) {
+	var post mattermostPost
+	if err := json.Unmarshal([]byte(event.Data.Post), &post); err != nil {
+		klog.Infof("unable to parse mattermost post: %v", err)
+		return
+	}
+	if len(post.Type) > 0 || post.UserID == f.botUserID {
+		return
+	}
+	direct := event.Data.ChannelType == "D"
+	if !direct {
+		var mentions []string
+		if len(event.Data.Mentions) > 0 {
+			if err := json.Unmarshal([]byte(event.Data.Mentions), &mentions); err != nil {
+				klog.Infof("unable to parse mattermost mentions: %v", err)
+				return
+			}
+		}
+		if !contains(mentions, f.botUserID) {
+			return
+		}
+	}
+
+	request := &ChatRequest{
+		User:    post.UserID,
+		Channel: post.ChannelID,
+		Text:    strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(post.Message), "@"+f.botUsername)),
+	}
+	if !direct {
+		request.Thread = post.RootID
+		if len(request.Thread) == 0 {
+			request.Thread = post.ID
+		}
+	}
+	f.lock.Lock()
+	f.channelTypes[post.ChannelID] = event.Data.ChannelType
+	f.lock.Unlock()
+	f.bot.HandleCommand(request, &channelResponse{frontend: f, channel: request.Channel, thread: request.Thread})
+}
+
+func (f *mattermostFrontend) PostMessage(channel, thread, message string, actions ...MessageAction) (string, string, error) {
+	channel, err := f.resolveChannel(channel)
+	if err != nil {
+		return "", "", err
+	}
+	text := f.markdown(message)
+	if hints := actionHints(actions); len(hints) > 0 {
+		text += "\n" + hints
+	}
+	var post mattermostPost
+	if err := f.do(http.MethodPost, "/posts", &mattermostPost{ChannelID: channel, RootID: thread, Message: text}, &post); err != nil {
+		return "", "", err
+	}
+	return channel, post.ID, nil
+}
+
+func (f *mattermostFrontend) UpdateMessage(channel, id, message string) error {
+	return f.do(http.MethodPut, fmt.Sprintf("/posts/%s/patch", id), map[string]string{"message": f.markdown(message)}, nil)
+}
+
+func (f *mattermostFrontend) UploadFile(channel, filename, contents, comment string) error {
+	channel, err := f.resolveChannel(channel)
+	if err != nil {
+		return err
+	}
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	if err := form.WriteField("channel_id", channel); err != nil {
+		return err
+	}
+	part, err := form.CreateFormFile("files", filename)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(part, contents); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+	var uploaded struct {
+		FileInfos []struct {
+			ID string `json:"id"`
+		} `json:"file_infos"`
+	}
+	if err := f.request(http.MethodPost, "/files", form.FormDataContentType(), body, &uploaded); err != nil {
+		return err
+	}
+	post := &mattermostPost{ChannelID: channel, Message: f.markdown(comment)}
+	for _, info := range uploaded.FileInfos {
+		post.FileIDs = append(post.FileIDs, info.ID)
+	}
+	return f.do(http.MethodPost, "/posts", post, nil)
+}
+
+func (f *mattermostFrontend) PrivateChannel(user string) (string, error) {
+	var channel struct {
+		ID string `json:"id"`
+	}
+	if err := f.do(http.MethodPost, "/channels/direct", []string{f.botUserID, user}, &channel); err != nil {
+		return "", err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.channelTypes[channel.ID] = "D"
+	return channel.ID, nil
+}
+
+func (f *mattermostFrontend) IsDirectChannel(channel string) bool {
+	channelType, err := f.channelType(channel)
+	if err != nil {
+		klog.Infof("unable to look up mattermost channel %s: %v", channel, err)
+		return false
+	}
+	return channelType == "D"
+}
+
+func (f *mattermostFrontend) GroupMembers(group string) ([]string, error) {
+	var result struct {
+		Members []struct {
+			ID string `json:"id"`
+		} `json:"members"`
+	}
+	if err := f.do(http.MethodGet, fmt.Sprintf("/groups/%s/members?per_page=200", group), nil, &result); err != nil {
+		return nil, err
+	}
+	var members []string
+	for _, member := range result.Members {
+		members = append(members, member.ID)
+	}
+	return members, nil
+}
+
+// channelType returns the type of a channel, or the empty string if there is no channel with the ID.
+func (f *mattermostFrontend) channelType(id string) (string, error) {
+	f.lock.Lock()
+	channelType, ok := f.channelTypes[id]
+	f.lock.Unlock()
+	if ok {
+		return channelType, nil
+	}
+	var channel struct {
+		Type string `json:"type"`
+	}
+	if err := f.do(http.MethodGet, "/channels/"+id, nil, &channel); err != nil {
+		if apiErr, ok := err.(*mattermostError); ok && apiErr.StatusCode == http.StatusNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.channelTypes[id] = channel.Type
+	return channel.Type, nil
+}
+
+// resolveChannel returns the direct message channel with a user if the ID is not a channel.
+// Mattermost user and channel IDs look the same, so the server is asked.
+func (f *mattermostFrontend) resolveChannel(id string) (string, error) {
+	channelType, err := f.channelType(id)
+	if err != nil {
+		return "", err
+	}
+	if len(channelType) > 0 {
+		return id, nil
+	}
+	return f.PrivateChannel(id)
+}
+
+// username returns the username of a user, or the ID if the user cannot be looked up.
+func (f *mattermostFrontend) username(id string) string {
+	f.lock.Lock()
+	username, ok := f.usernames[id]
+	f.lock.Unlock()
+	if ok {
+		return username
+	}
+	var user struct {
+		Username string `json:"username"`
+	}
+	if err := f.do(http.MethodGet, "/users/"+id, nil, &user); err != nil {
+		klog.Infof("unable to look up mattermost user %s: %v", id, err)
+		return id
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.usernames[id] = user.Username
+	return user.Username
+}
+
+var (
+	slackLabeledLink = regexp.MustCompile(`<([a-z]+://[^|>]+)\|([^>]+)>`)
+	slackLink        = regexp.MustCompile(`<([a-z]+://[^|>]+)>`)
+	slackUserMention = regexp.MustCompile(`<@([A-Za-z0-9]+)>`)
+	slackBold        = regexp.MustCompile("(^|[\\s(>_])\\*([^*\\n]+)\\*")
+)
+
+// markdown translates the Slack markup of the bot's messages to Markdown.
+func (f *mattermostFrontend) markdown(message string) string {
+	message = slackLabeledLink.ReplaceAllString(message, "[$2]($1)")
+	message = slackLink.ReplaceAllString(message, "$1")
+	message = slackUserMention.ReplaceAllStringFunc(message, func(mention string) string {
+		return "@" + f.username(slackUserMention.FindStringSubmatch(mention)[1])
+	})
+	return slackBold.ReplaceAllString(message, "$1**$2**")
+}
+
+// actionHints describes the commands that do what the offered actions do, since posts of a bot
+// without an integration endpoint cannot have buttons.
+func actionHints(actions []MessageAction) string {
+	var hints []string
+	for _, action := range actions {
+		_, cluster := parseJobActionValue(action.Value)
+		var command string
+		switch action.ID {
+		case ActionLogs:
+			hints = append(hints, fmt.Sprintf("[%s](%s)", action.Label, action.Value))
+			continue
+		case ActionDone, ActionAuth, ActionKeep:
+			command = strings.TrimSpace(action.ID + " " + cluster)
+		case ActionExtend:
+			command = strings.TrimSpace("extend 1h " + cluster)
+		case ActionApprove:
+			command = "approve " + action.Value
+		case ActionDeny:
+			command = fmt.Sprintf("deny %s <reason>", action.Value)
+		default:
+			continue
+		}
+		hints = append(hints, fmt.Sprintf("%s: `%s`", action.Label, command))
+	}
+	return strings.Join(hints, " | ")
+}
+
+// mattermostError is an error response of the REST API.
+type mattermostError struct {
+	StatusCode int
+	Message    string `json:"message"`
+}
+
+func (e *mattermostError) Error() string {
+	return fmt.Sprintf("mattermost API returned %d: %s", e.StatusCode, e.Message)
+}
+
+// do sends a JSON request to the REST API and decodes the JSON response into result, if set.
+func (f *mattermostFrontend) do(method, path string, body interface{}, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	return f.request(method, path, "application/json", reader, result)
+}
+
+func (f *mattermostFrontend) request(method, path, contentType string, body io.Reader, result interface{}) error {
+	req, err := http.NewRequest(method, f.url+"/api/v4"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+f.token)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		apiErr := &mattermostError{StatusCode: resp.StatusCode}
+		if err := json.Unmarshal(data, apiErr); err != nil {
+			apiErr.Message = string(data)
+		}
+		return apiErr
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
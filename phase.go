@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/klog"
+	prowapiv1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
+)
+
+// JobPhase is where a job is in its lifecycle. Clusters go from Creating through Scheduled and
+// Installing to Ready, other jobs from Creating to Testing. Either ends in Succeeded or Failed, and
+// clusters that run until their lifetime is over end in Expired.
+type JobPhase string
+
+const (
+	// JobPhaseQueued jobs are on the waitlist until a cluster slot is free
+	JobPhaseQueued JobPhase = "Queued"
+	// JobPhaseCreating jobs have a prow job that has not started its pod yet
+	JobPhaseCreating JobPhase = "Creating"
+	// JobPhaseScheduled clusters have a running prow job pod
+	JobPhaseScheduled JobPhase = "Scheduled"
+	// JobPhaseInstalling clusters are being installed
+	JobPhaseInstalling JobPhase = "Installing"
+	// JobPhaseReady clusters can be used and their credentials have been sent
+	JobPhaseReady JobPhase = "Ready"
+	// JobPhaseTesting jobs are running their tests or builds
+	JobPhaseTesting JobPhase = "Testing"
+	// JobPhaseTearingDown clusters have been asked to shut down before the end of their lifetime
+	JobPhaseTearingDown JobPhase = "TearingDown"
+	// JobPhaseSucceeded jobs passed, or clusters shut down when asked to
+	JobPhaseSucceeded JobPhase = "Succeeded"
+	// JobPhaseFailed jobs failed, or clusters failed to launch
+	JobPhaseFailed JobPhase = "Failed"
+	// JobPhaseExpired clusters were shut down at the end of their lifetime
+	JobPhaseExpired JobPhase = "Expired"
+)
+
+// jobPhaseTransitions lists the phases a job may move to from each phase. Jobs that are created or
+// restored may start in any phase.
+var jobPhaseTransitions = map[JobPhase][]JobPhase{
+	JobPhaseQueued:      {JobPhaseCreating, JobPhaseFailed},
+	JobPhaseCreating:    {JobPhaseScheduled, JobPhaseTesting, JobPhaseTearingDown, JobPhaseSucceeded, JobPhaseFailed, JobPhaseExpired},
+	JobPhaseScheduled:   {JobPhaseInstalling, JobPhaseTearingDown, JobPhaseSucceeded, JobPhaseFailed, JobPhaseExpired},
+	JobPhaseInstalling:  {JobPhaseReady, JobPhaseTearingDown, JobPhaseSucceeded, JobPhaseFailed, JobPhaseExpired},
+	JobPhaseReady:       {JobPhaseTearingDown, JobPhaseSucceeded, JobPhaseFailed, JobPhaseExpired},
+	JobPhaseTesting:     {JobPhaseTearingDown, JobPhaseSucceeded, JobPhaseFailed},
+	JobPhaseTearingDown: {JobPhaseSucceeded},
+	// a cluster that failed to launch while its prow job still runs may be refreshed
+	JobPhaseFailed: {JobPhaseCreating},
+}
+
+// known reports whether the phase is one of the phases above.
+func (p JobPhase) known() bool {
+	switch p {
+	case JobPhaseQueued, JobPhaseCreating, JobPhaseScheduled, JobPhaseInstalling, JobPhaseReady, JobPhaseTesting,
+		JobPhaseTearingDown, JobPhaseSucceeded, JobPhaseFailed, JobPhaseExpired:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo reports whether a job in this phase may move to the next phase.
+func (p JobPhase) CanTransitionTo(next JobPhase) bool {
+	if len(p) == 0 {
+		return true
+	}
+	for _, allowed := range jobPhaseTransitions[p] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Stopped reports whether the job has ended or is shutting down, so there is nothing left to wait for.
+func (p JobPhase) Stopped() bool {
+	switch p {
+	case JobPhaseTearingDown, JobPhaseSucceeded, JobPhaseFailed, JobPhaseExpired:
+		return true
+	}
+	return false
+}
+
+// setPhase moves a job to the next phase if the transition is allowed.
+func (j *Job) setPhase(next JobPhase) error {
+	if j.Phase == next {
+		return nil
+	}
+	if !j.Phase.CanTransitionTo(next) {
+		return fmt.Errorf("job %s may not go from %s to %s", j.Name, j.Phase, next)
+	}
+	j.Phase = next
+	return nil
+}
+
+// phaseForLaunchStep is the phase a cluster is in once its launch has completed a step.
+func phaseForLaunchStep(step LaunchStep) JobPhase {
+	switch step {
+	case LaunchStepCreated, LaunchStepURLAssigned:
+		return JobPhaseCreating
+	case LaunchStepScheduled:
+		return JobPhaseScheduled
+	case LaunchStepReady:
+		return JobPhaseReady
+	}
+	return JobPhaseInstalling
+}
+
+// observedPhase is the phase of a job given the state of its prow job. Prow only knows whether a
+// job is running, so the phase of a running job is kept unless it is not known yet.
+func observedPhase(job *Job, state prowapiv1.ProwJobState) JobPhase {
+	launch := job.Mode == JobTypeLaunch || job.Mode == JobTypeWorkflowLaunch
+	switch state {
+	case prowapiv1.SuccessState, prowapiv1.FailureState, prowapiv1.ErrorState, prowapiv1.AbortedState:
+		switch {
+		case job.Phase == JobPhaseTearingDown:
+			// whatever happened to the prow job, the cluster is gone as requested
+			return JobPhaseSucceeded
+		case state == prowapiv1.SuccessState && launch:
+			return JobPhaseExpired
+		case state == prowapiv1.SuccessState:
+			return JobPhaseSucceeded
+		case state == prowapiv1.AbortedState && launch:
+			return JobPhaseSucceeded
+		}
+		return JobPhaseFailed
+	}
+	switch {
+	case len(job.Phase) > 0:
+		return job.Phase
+	case launch || len(job.URL) == 0:
+		return JobPhaseCreating
+	}
+	return JobPhaseTesting
+}
+
+// observePhase moves a job to the phase of its prow job, unless the job may not get there from
+// where it is.
+func (j *Job) observePhase(state prowapiv1.ProwJobState) {
+	if next := observedPhase(j, state); j.Phase.CanTransitionTo(next) {
+		j.Phase = next
+	}
+}
+
+// setPhase moves a job to the next phase if the transition is allowed, checked against the tracked
+// job if there is one. The change is recorded on the prow job by the next sync. Caller must hold
+// the lock.
+func (m *jobManager) setPhase(job *Job, next JobPhase) bool {
+	current := job
+	if tracked, ok := m.jobs[job.Name]; ok {
+		current = tracked
+	}
+	if current.Phase == next {
+		job.Phase = next
+		return false
+	}
+	if err := current.setPhase(next); err != nil {
+		klog.Infof("Ignoring phase change: %v", err)
+		return false
+	}
+	job.Phase = next
+	klog.Infof("Job %q is %s", job.Name, next)
+	m.userChanged(job.RequestedBy)
+	m.requestSync()
+	return true
+}
+
+// updatePhase moves a job to the next phase.
+func (m *jobManager) updatePhase(job *Job, next JobPhase) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.setPhase(job, next)
+}
+
+// recordPhase records the phase of a job on its prow job, so it is known after a restart.
+func (m *jobManager) recordPhase(name string, phase JobPhase) {
+	if err := m.annotateJob(name, map[string]string{annotationPhase: string(phase)}); err != nil {
+		klog.Infof("error: Job %q unable to record phase %s: %v", name, phase, err)
+	}
+}
+
+// phaseDescription describes the phase of a cluster or job to its owner.
+func phaseDescription(job *Job) string {
+	launch := job.Mode == JobTypeLaunch || job.Mode == JobTypeWorkflowLaunch
+	switch job.Phase {
+	case JobPhaseQueued:
+		return "waiting for a cluster slot"
+	case JobPhaseCreating:
+		if !launch {
+			return "pending"
+		}
+		return "being created"
+	case JobPhaseScheduled:
+		return "scheduled"
+	case JobPhaseInstalling:
+		return "installing"
+	case JobPhaseReady:
+		return "available"
+	case JobPhaseTesting:
+		return "running"
+	case JobPhaseTearingDown:
+		return "shutting down"
+	case JobPhaseSucceeded:
+		if launch {
+			return "shut down"
+		}
+		return "succeeded"
+	case JobPhaseFailed:
+		return "failed"
+	case JobPhaseExpired:
+		return "expired"
+	}
+	return "pending"
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// progressMessage is the message that shows the owner of a cluster how far its launch has come.
+type progressMessage struct {
+	channel string
+	id      string
+	step    LaunchStep
+}
+
+// progressResponder posts a progress message for each launch when it starts and edits it in place
+// as the launch moves through its steps. Updates for a launch are applied in order and updates
+// that arrive late are dropped. A launch whose message was posted before a restart keeps editing
+// that message.
+func (b *Bot) progressResponder() ProgressCallbackFunc {
+	return func(job Job, estimate time.Duration) (string, string) {
+		b.progressLock.Lock()
+		defer b.progressLock.Unlock()
+
+		finished := job.IsComplete()
+		msg, ok := b.progress[job.Name]
+		if ok && job.Progress < msg.step && !finished {
+			return msg.channel, msg.id
+		}
+		if !ok {
+			if parts := strings.SplitN(job.ProgressMessage, "/", 2); len(parts) == 2 {
+				msg, ok = &progressMessage{channel: parts[0], id: parts[1]}, true
+				b.progress[job.Name] = msg
+			}
+		}
+		text := progressText(job, estimate, time.Now())
+		if !ok {
+			channel, id, err := b.frontend.PostMessage(job.RequestedChannel, job.RequestedThread, text)
+			if err != nil {
+				klog.Warningf("Failed to post progress of job %q: %v", job.Name, err)
+				return "", ""
+			}
+			msg = &progressMessage{channel: channel, id: id}
+			b.progress[job.Name] = msg
+		} else if err := b.frontend.UpdateMessage(msg.channel, msg.id, text); err != nil {
+			klog.Warningf("Failed to update progress of job %q: %v", job.Name, err)
+		}
+		msg.step = job.Progress
+
+		if finished {
+			delete(b.progress, job.Name)
+		}
+		return msg.channel, msg.id
+	}
+}
+
+// progressText lists the steps of a launch, with the ones that completed checked off and the time
+// the launch has taken so far against how long launches usually take. Each completed step shows how
+// long it took and the step the launch is working on shows when it started, since the message is
+// only edited when a step completes.
+func progressText(job Job, estimate time.Duration, now time.Time) string {
+	elapsed := int(now.Sub(job.RequestedAt) / time.Minute)
+	failed := job.Phase == JobPhaseFailed
+
+	var lines []string
+	switch {
+	case failed:
+		lines = append(lines, fmt.Sprintf("*Your cluster failed to launch* after %d minutes: %s", elapsed, job.Failure))
+	case job.Phase == JobPhaseReady:
+		lines = append(lines, fmt.Sprintf("*Your cluster is ready* after %d minutes", elapsed))
+	case job.Phase.Stopped():
+		lines = append(lines, fmt.Sprintf("*Your cluster launch was stopped* after %d minutes", elapsed))
+	default:
+		lines = append(lines, fmt.Sprintf("*Your cluster is launching* - %d minutes elapsed, launches usually take about %d minutes", elapsed, int(estimate/time.Minute)))
+	}
+	// steps take from when the previous step completed, the first from when the job was requested
+	previous := job.RequestedAt
+	for step := LaunchStepCreated; step <= LaunchStepReady; step++ {
+		var marker, timing string
+		reachedAt := job.ProgressAt[step]
+		switch {
+		case step <= job.Progress:
+			marker = ":white_check_mark:"
+			if !reachedAt.IsZero() && !previous.IsZero() {
+				timing = fmt.Sprintf(" - took %s", stepDuration(reachedAt.Sub(previous)))
+			}
+		case step == job.Progress+1 && failed:
+			marker = ":x:"
+		case step == job.Progress+1 && !job.Phase.Stopped():
+			marker = ":hourglass_flowing_sand:"
+			if !previous.IsZero() && !job.RequestedAt.IsZero() {
+				timing = fmt.Sprintf(" - started %s in", stepDuration(previous.Sub(job.RequestedAt)))
+			}
+		default:
+			marker = ":white_small_square:"
+		}
+		if !reachedAt.IsZero() {
+			previous = reachedAt
+		}
+		label := step.String()
+		if step == LaunchStepURLAssigned && len(job.URL) > 0 {
+			label = fmt.Sprintf("<%s|%s>", job.URL, label)
+		}
+		lines = append(lines, fmt.Sprintf("%s %s%s", marker, label, timing))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// stepDuration describes how long a step of a launch took, to the minute.
+func stepDuration(d time.Duration) string {
+	if d < time.Minute {
+		return "less than a minute"
+	}
+	if d < 2*time.Minute {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", int(d/time.Minute))
+}
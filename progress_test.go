@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressText(t *testing.T) {
+	requestedAt := time.Unix(1700000000, 0)
+	job := Job{
+		Name:        "chat-bot-2023-11-14-221320.0000",
+		Mode:        JobTypeLaunch,
+		Phase:       JobPhaseInstalling,
+		Progress:    LaunchStepInstalling,
+		RequestedAt: requestedAt,
+	}
+	job.ProgressAt[LaunchStepCreated] = requestedAt.Add(10 * time.Second)
+	job.ProgressAt[LaunchStepURLAssigned] = requestedAt.Add(90 * time.Second)
+	job.ProgressAt[LaunchStepInstalling] = requestedAt.Add(6 * time.Minute)
+
+	lines := strings.Split(progressText(job, 30*time.Minute, requestedAt.Add(20*time.Minute)), "\n")
+	expected := []string{
+		"*Your cluster is launching* - 20 minutes elapsed, launches usually take about 30 minutes",
+		":white_check_mark: Prow job created - took less than a minute",
+		":white_check_mark: Logs available - took 1 minute",
+		// the pod was scheduled without being reported before the install started
+		":white_check_mark: Pod scheduled",
+		":white_check_mark: Installing the cluster - took 4 minutes",
+		":hourglass_flowing_sand: Kubeconfig available - started 6 minutes in",
+		":white_small_square: API reachable",
+		":white_small_square: Ready",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %d:\n%s", len(expected), len(lines), strings.Join(lines, "\n"))
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("line %d: expected %q, got %q", i, expected[i], lines[i])
+		}
+	}
+
+	job.Phase, job.Failure = JobPhaseFailed, "install failed"
+	if lines := strings.Split(progressText(job, 30*time.Minute, requestedAt.Add(20*time.Minute)), "\n"); lines[5] != ":x: Kubeconfig available" {
+		t.Errorf("expected the failed step without timing, got %q", lines[5])
+	}
+}
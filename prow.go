@@ -296,6 +296,27 @@ func (m *jobManager) stopJob(name, cluster string) error {
 	return err
 }
 
+// extendJob moves the expiration of a running cluster to the provided time. Clusters that may be
+// extended run for their maximum lifetime and are stopped by the bot when they expire, so only the
+// expiration recorded on the ProwJob changes.
+func (m *jobManager) extendJob(job *Job, expiresAt time.Time) error {
+	uns, err := m.prowClient.Namespace(m.prowNamespace).Get(context.TODO(), job.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	var pj prowapiv1.ProwJob
+	if err := prow.UnstructuredToObject(uns, &pj); err != nil {
+		return err
+	}
+	if err := m.annotateJob(job.Name, map[string]string{
+		annotationExpires:       strconv.Itoa(int(expiresAt.Sub(pj.CreationTimestamp.Time).Seconds())),
+		annotationExpiryWarning: "",
+	}); err != nil {
+		return fmt.Errorf("could not update the prow job expiration: %v", err)
+	}
+	return nil
+}
+
 // newJob creates a ProwJob for running the provided job and exits.
 func (m *jobManager) newJob(job *Job) (string, error) {
 	if !m.tryJob(job.Name) {
@@ -317,31 +338,18 @@ func (m *jobManager) newJob(job *Job) (string, error) {
 		return "", err
 	}
 
-	jobInputData, err := json.Marshal(job.Inputs)
+	annotations, err := encodeJobAnnotations(job, namespace)
 	if err != nil {
 		return "", err
 	}
+	annotations["prow.k8s.io/job"] = pj.Spec.Job
 
 	pj.ObjectMeta = metav1.ObjectMeta{
-		Name:      job.Name,
-		Namespace: m.prowNamespace,
-		Annotations: map[string]string{
-			"ci-chat-bot.openshift.io/originalMessage": job.OriginalMessage,
-			"ci-chat-bot.openshift.io/mode":            job.Mode,
-			"ci-chat-bot.openshift.io/jobParams":       paramsToString(job.JobParams),
-			"ci-chat-bot.openshift.io/user":            job.RequestedBy,
-			"ci-chat-bot.openshift.io/channel":         job.RequestedChannel,
-			"ci-chat-bot.openshift.io/ns":              namespace,
-			"ci-chat-bot.openshift.io/platform":        job.Platform,
-			"ci-chat-bot.openshift.io/jobInputs":       string(jobInputData),
-			"ci-chat-bot.openshift.io/buildCluster":    job.BuildCluster,
-
-			"prow.k8s.io/job": pj.Spec.Job,
-
-			"release.openshift.io/architecture": job.Architecture,
-		},
+		Name:        job.Name,
+		Namespace:   m.prowNamespace,
+		Annotations: annotations,
 		Labels: map[string]string{
-			"ci-chat-bot.openshift.io/launch": "true",
+			labelLaunch: "true",
 
 			"prow.k8s.io/type": string(pj.Spec.Type),
 			"prow.k8s.io/job":  pj.Spec.Job,
@@ -365,8 +373,20 @@ func (m *jobManager) newJob(job *Job) (string, error) {
 		pj.Annotations["release.openshift.io/tag"] = job.Inputs[1].Version
 	}
 	// set standard annotations and environment variables
-	pj.Annotations["ci-chat-bot.openshift.io/expires"] = strconv.Itoa(int(m.maxAge.Seconds() + launchDeadline.Seconds()))
-	prow.OverrideJobEnvVar(&pj.Spec, "CLUSTER_DURATION", strconv.Itoa(int(m.maxAge.Seconds())))
+	pj.Annotations[annotationExpires] = strconv.Itoa(int(m.lifetime(job).Seconds() + launchDeadline.Seconds()))
+	// clusters that may be extended stay up for the maximum lifetime unless the bot stops them
+	// when they expire
+	clusterDuration := m.lifetime(job)
+	if m.extendEnabled {
+		clusterDuration = m.maxLifetimeFor(job)
+	}
+	prow.OverrideJobEnvVar(&pj.Spec, "CLUSTER_DURATION", strconv.Itoa(int(clusterDuration.Seconds())))
+	// the job must not time out while a cluster that may run for longer than the default is up
+	if pj.Spec.DecorationConfig != nil && (m.extendEnabled || job.Lifetime > m.maxAge) {
+		if timeout := clusterDuration + launchDeadline; pj.Spec.DecorationConfig.Timeout == nil || pj.Spec.DecorationConfig.Timeout.Duration < timeout {
+			pj.Spec.DecorationConfig.Timeout = &prowapiv1.Duration{Duration: timeout}
+		}
+	}
 	if job.Mode == "build" {
 		prow.SetJobEnvVar(&pj.Spec, "PRESERVE_DURATION", "12h")
 	} else {
@@ -771,7 +791,7 @@ func (m *jobManager) newJob(job *Job) (string, error) {
 	} else {
 		job.TargetType = "template"
 	}
-	pj.Annotations["ci-chat-bot.openshift.io/targetType"] = job.TargetType
+	pj.Annotations[annotationTargetType] = job.TargetType
 
 	// build jobs do not launch contents
 	if job.Mode == JobTypeBuild {
@@ -837,30 +857,29 @@ func (m *jobManager) waitForJob(job *Job) error {
 	stepBasedMode := job.TargetType == "steps"
 
 	klog.Infof("Job %q started a prow job that will create pods in namespace %s", job.Name, namespace)
+	m.reportProgress(job, LaunchStepCreated)
 	var pj *prowapiv1.ProwJob
-	err := wait.PollImmediate(10*time.Second, 15*time.Minute, func() (bool, error) {
+	err := m.waitForJobChange(job.Name, 15*time.Minute, func() (bool, error) {
 		if m.jobIsComplete(job) {
 			return false, errJobCompleted
 		}
-		uns, err := m.prowClient.Namespace(m.prowNamespace).Get(context.TODO(), job.Name, metav1.GetOptions{})
+		latestPJ, err := m.getProwJob(job.Name)
 		if err != nil {
 			return false, err
 		}
-		var latestPJ prowapiv1.ProwJob
-		if err := prow.UnstructuredToObject(uns, &latestPJ); err != nil {
-			return false, err
-		}
-		pj = &latestPJ
+		pj = latestPJ
 
 		var done bool
 		switch pj.Status.State {
 		case prowapiv1.AbortedState, prowapiv1.ErrorState, prowapiv1.FailureState:
 			job.Failure = "job failed"
 			job.State = pj.Status.State
+			job.observePhase(job.State)
 			done = true
 		case prowapiv1.SuccessState:
 			job.Failure = ""
 			job.State = pj.Status.State
+			job.observePhase(job.State)
 			done = true
 		}
 		if len(pj.Status.URL) > 0 {
@@ -873,39 +892,39 @@ func (m *jobManager) waitForJob(job *Job) error {
 		return fmt.Errorf("did not retrieve job url due to an error: %v", err)
 	}
 
-	if job.IsComplete() {
-		if value := pj.Annotations["ci-chat-bot.openshift.io/channel"]; len(value) > 0 {
+	if job.Phase.Stopped() {
+		if value := pj.Annotations[annotationChannel]; len(value) > 0 {
 			m.clearNotificationAnnotations(job, false, 0)
 		}
 		return nil
 	}
 
 	started := pj.Status.StartTime.Time
+	m.reportProgress(job, LaunchStepURLAssigned)
 
 	if job.Mode != JobTypeLaunch && job.Mode != JobTypeWorkflowLaunch {
 		klog.Infof("Job %s will report results at %s (to %s / %s)", job.Name, job.URL, job.RequestedBy, job.RequestedChannel)
+		m.updatePhase(job, JobPhaseTesting)
 
 		// loop waiting for job to complete
-		err = wait.PollImmediate(time.Minute, 5*60*time.Minute, func() (bool, error) {
+		err = m.waitForJobChange(job.Name, 5*60*time.Minute, func() (bool, error) {
 			if m.jobIsComplete(job) {
 				return false, errJobCompleted
 			}
-			uns, err := m.prowClient.Namespace(m.prowNamespace).Get(context.TODO(), job.Name, metav1.GetOptions{})
+			pj, err := m.getProwJob(job.Name)
 			if err != nil {
 				return false, err
 			}
-			var pj prowapiv1.ProwJob
-			if err := prow.UnstructuredToObject(uns, &pj); err != nil {
-				return false, err
-			}
 			switch pj.Status.State {
 			case prowapiv1.AbortedState, prowapiv1.ErrorState, prowapiv1.FailureState:
 				job.Failure = "job failed"
 				job.State = pj.Status.State
+				job.observePhase(job.State)
 				return true, nil
 			case prowapiv1.SuccessState:
 				job.Failure = ""
 				job.State = pj.Status.State
+				job.observePhase(job.State)
 				return true, nil
 			}
 			return false, nil
@@ -932,16 +951,16 @@ func (m *jobManager) waitForJob(job *Job) error {
 		}
 	}
 
+	prowJobPods, err := m.buildClusterPods(job.BuildCluster)
+	if err != nil {
+		return err
+	}
 	seen := false
-	err = wait.PollImmediate(5*time.Second, 15*time.Minute, func() (bool, error) {
+	err = m.waitForJobChange(job.Name, 15*time.Minute, func() (bool, error) {
 		if m.jobIsComplete(job) {
 			return false, errJobCompleted
 		}
-		clusterClient, err := getClusterClient(m, job)
-		if err != nil {
-			return false, err
-		}
-		pod, err := clusterClient.CoreClient.CoreV1().Pods(m.prowNamespace).Get(context.TODO(), job.Name, metav1.GetOptions{})
+		pod, err := prowJobPods.Get(job.Name)
 		if err != nil {
 			if !errors.IsNotFound(err) {
 				return false, err
@@ -963,34 +982,43 @@ func (m *jobManager) waitForJob(job *Job) error {
 		}
 		return fmt.Errorf("unable to check launch status: %v", err)
 	}
+	m.reportProgress(job, LaunchStepScheduled)
 
 	klog.Infof("Job %q waiting for setup container in pod %s to complete", job.Name, namespace)
 
 	seen = false
+	installing := func() {
+		if job.Progress < LaunchStepInstalling {
+			m.reportProgress(job, LaunchStepInstalling)
+		}
+	}
+	clusterClient, err := getClusterClient(m, job)
+	if err != nil {
+		return err
+	}
+	launchNamespace := m.watchNamespace(job, clusterClient.CoreClient, namespace, stepBasedMode)
+	defer launchNamespace.Stop()
 	var lastErr error
-	err = wait.PollImmediate(15*time.Second, 60*time.Minute, func() (bool, error) {
+	err = m.waitForJobChange(job.Name, 60*time.Minute, func() (bool, error) {
 		if m.jobIsComplete(job) {
 			return false, errJobCompleted
 		}
 
-		clusterClient, err := getClusterClient(m, job)
-		if err != nil {
-			return false, err
-		}
 		if stepBasedMode {
-			prowJobPod, err := clusterClient.CoreClient.CoreV1().Pods(m.prowNamespace).Get(context.TODO(), job.Name, metav1.GetOptions{})
+			prowJobPod, err := prowJobPods.Get(job.Name)
 			if err != nil {
 				return false, err
 			}
 			if prowJobPod.Status.Phase == "Succeeded" || prowJobPod.Status.Phase == "Failed" {
 				return false, errJobCompleted
 			}
-			launchSecret, err := clusterClient.CoreClient.CoreV1().Secrets(namespace).Get(context.TODO(), targetName, metav1.GetOptions{})
+			launchSecret, err := launchNamespace.secrets.Get(targetName)
 			if err != nil {
 				// It will take awhile before the secret is established and for the ci-chat-bot serviceaccount
 				// to get permission to access it (see openshift-cluster-bot-rbac step). Ignore errors.
 				return false, nil
 			}
+			installing()
 			if _, ok := launchSecret.Data["console.url"]; ok {
 				// If the console.url is established, the cluster was setup.
 				return true, nil
@@ -998,10 +1026,10 @@ func (m *jobManager) waitForJob(job *Job) error {
 			return false, nil
 		} else {
 			// Execute in template based mode where actual installation pod is monitored.
-			pod, err := clusterClient.CoreClient.CoreV1().Pods(namespace).Get(context.TODO(), targetName, metav1.GetOptions{})
+			pod, err := launchNamespace.pods.Get(targetName)
 			if err != nil {
 				// pod could not be created or we may not have permission yet
-				if !errors.IsNotFound(err) && !errors.IsForbidden(err) {
+				if !errors.IsNotFound(err) {
 					lastErr = err
 					return false, err
 				}
@@ -1011,6 +1039,7 @@ func (m *jobManager) waitForJob(job *Job) error {
 				return false, nil
 			}
 			seen = true
+			installing()
 			if pod.DeletionTimestamp != nil {
 				return false, fmt.Errorf("cluster is being torn down")
 			}
@@ -1038,12 +1067,8 @@ func (m *jobManager) waitForJob(job *Job) error {
 	}
 
 	var kubeconfig string
-	clusterClient, err := getClusterClient(m, job)
-	if err != nil {
-		return err
-	}
 	if stepBasedMode {
-		launchSecret, err := clusterClient.CoreClient.CoreV1().Secrets(namespace).Get(context.TODO(), targetName, metav1.GetOptions{})
+		launchSecret, err := launchNamespace.secrets.Get(targetName)
 		if err == nil {
 			if content, ok := launchSecret.Data["kubeconfig"]; ok {
 				kubeconfig = string(content)
@@ -1065,7 +1090,7 @@ func (m *jobManager) waitForJob(job *Job) error {
 			if err != nil {
 				if strings.Contains(err.Error(), "container not found") {
 					// periodically check whether the still exists and is not succeeded or failed
-					pod, err := clusterClient.CoreClient.CoreV1().Pods(namespace).Get(context.TODO(), targetName, metav1.GetOptions{})
+					pod, err := launchNamespace.pods.Get(targetName)
 					if errors.IsNotFound(err) || (pod != nil && (pod.Status.Phase == "Succeeded" || pod.Status.Phase == "Failed")) {
 						return false, fmt.Errorf("pod cannot be found or has been deleted, assume cluster won't come up")
 					}
@@ -1084,6 +1109,7 @@ func (m *jobManager) waitForJob(job *Job) error {
 	}
 
 	job.Credentials = kubeconfig
+	m.reportProgress(job, LaunchStepKubeconfig)
 
 	// once the cluster is reachable, we're ok to send credentials
 	// TODO: better criteria?
@@ -1092,11 +1118,13 @@ func (m *jobManager) waitForJob(job *Job) error {
 		klog.Infof("error: Job %q failed waiting for cluster to become reachable in %s: %v", job.Name, namespace, err)
 		job.Credentials = ""
 		waitErr = fmt.Errorf("cluster did not become reachable: %v", err)
+	} else {
+		m.reportProgress(job, LaunchStepReachable)
 	}
 
 	var kubeadminPassword string
 	if stepBasedMode {
-		launchSecret, err := clusterClient.CoreClient.CoreV1().Secrets(namespace).Get(context.TODO(), targetName, metav1.GetOptions{})
+		launchSecret, err := launchNamespace.secrets.Get(targetName)
 		if err != nil {
 			return fmt.Errorf("unable to retrieve step secret %s/%s: %v", namespace, targetName, err)
 		}
@@ -1133,7 +1161,10 @@ func (m *jobManager) waitForJob(job *Job) error {
 		job.PasswordSnippet = fmt.Sprintf("\nError: Unable to retrieve kubeadmin password, you must use the kubeconfig file to access the cluster")
 	}
 
-	created := len(pj.Annotations["ci-chat-bot.openshift.io/expires"]) == 0
+	if waitErr == nil {
+		m.reportProgress(job, LaunchStepReady)
+	}
+	created := len(pj.Annotations[annotationExpires]) == 0
 	startDuration := time.Now().Sub(started)
 	m.clearNotificationAnnotations(job, created, startDuration)
 
@@ -1145,17 +1176,31 @@ var reFixLines = regexp.MustCompile(`(?m)^level=info msg=\"(.*)\"$`)
 // clearNotificationAnnotations removes the channel notification annotations in case we crash,
 // so we don't attempt to redeliver, and set the best estimate we have of the expiration time if we created the cluster
 func (m *jobManager) clearNotificationAnnotations(job *Job, created bool, startDuration time.Duration) {
-	var patch []byte
+	annotations := map[string]string{annotationChannel: ""}
 	if created {
-		patch = []byte(fmt.Sprintf(`{"metadata":{"annotations":{"ci-chat-bot.openshift.io/channel":"","ci-chat-bot.openshift.io/expires":"%d"}}}`, int(startDuration.Seconds()+m.maxAge.Seconds())))
-	} else {
-		patch = []byte(`{"metadata":{"annotations":{"ci-chat-bot.openshift.io/channel":""}}}`)
+		annotations[annotationExpires] = strconv.Itoa(int(startDuration.Seconds() + m.lifetime(job).Seconds()))
 	}
-	if _, err := m.prowClient.Namespace(m.prowNamespace).Patch(context.TODO(), job.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+	if err := m.annotateJob(job.Name, annotations); err != nil {
 		klog.Infof("error: Job %q unable to clear channel annotation from prow job: %v", job.Name, err)
 	}
 }
 
+// recordExpiryWarning records on the prow job that the owner has been warned the cluster will
+// expire within the given threshold, so the warning is not repeated.
+func (m *jobManager) recordExpiryWarning(name string, threshold time.Duration) error {
+	return m.annotateJob(name, map[string]string{annotationExpiryWarning: strconv.Itoa(int(threshold.Seconds()))})
+}
+
+// annotateJob sets the provided annotations on the prow job.
+func (m *jobManager) annotateJob(name string, annotations map[string]string) error {
+	patch, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": annotations}})
+	if err != nil {
+		return err
+	}
+	_, err = m.prowClient.Namespace(m.prowNamespace).Patch(context.TODO(), name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
 // waitForClusterReachable performs a slow poll, waiting for the cluster to come alive.
 // It returns an error if the cluster doesn't respond within the time limit.
 func waitForClusterReachable(kubeconfig string, abortFn func() bool) error {
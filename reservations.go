@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// reservationTimeFormat is the format users give the start of a reservation in, always in UTC.
+const reservationTimeFormat = "2006-01-02T15:04"
+
+// Reservation books cluster capacity on a platform ahead of time. While the reservation is active
+// its slots are held back from everyone else and clusters are launched for the owner when it starts.
+type Reservation struct {
+	ID       string
+	User     string
+	Channel  string
+	Count    int
+	Platform string
+	Start    time.Time
+	Duration time.Duration
+
+	// Launched is set once the clusters for the reservation have been requested.
+	Launched bool
+	// Failed is the number of clusters that could not be launched, their slots are no longer held.
+	Failed int
+}
+
+// End returns the time the reservation is over.
+func (r *Reservation) End() time.Time {
+	return r.Start.Add(r.Duration)
+}
+
+// Active returns true if the reservation window contains the given time.
+func (r *Reservation) Active(now time.Time) bool {
+	return !now.Before(r.Start) && now.Before(r.End())
+}
+
+func (r *Reservation) overlaps(other *Reservation) bool {
+	return r.Start.Before(other.End()) && other.Start.Before(r.End())
+}
+
+// clusterName is the name of the nth cluster launched for the reservation.
+func (r *Reservation) clusterName(n int) string {
+	return fmt.Sprintf("%s-%d", r.ID, n)
+}
+
+// parseReservationStart accepts a start time in UTC or in RFC3339 format.
+func parseReservationStart(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation(reservationTimeFormat, value, time.UTC); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("the start time must be given in UTC like `2006-01-02T15:04`")
+}
+
+func (m *jobManager) ReserveForUser(r *Reservation) (string, error) {
+	now := time.Now()
+	if r.Count < 1 {
+		return "", fmt.Errorf("you must reserve at least one cluster")
+	}
+	if r.Duration < time.Hour {
+		return "", fmt.Errorf("reservations must be at least one hour long")
+	}
+	if r.Duration > m.maxLifetime {
+		return "", fmt.Errorf("reservations may not be longer than %s", m.maxLifetime)
+	}
+	if !r.End().After(now) || r.Start.Before(now.Add(-time.Minute)) {
+		return "", fmt.Errorf("reservations must start in the future")
+	}
+	if !contains(supportedPlatforms, r.Platform) {
+		return "", fmt.Errorf("unrecognized platform %q, must be one of: %s", r.Platform, strings.Join(supportedPlatforms, ", "))
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	// overlapping reservations are counted as if they were all active at the same time
+	limit := m.maxClusters
+	if m.capacity != nil {
+		if platformLimit, _ := m.capacity.Limits(r.Platform, ""); platformLimit > 0 && platformLimit < limit {
+			limit = platformLimit
+		}
+	}
+	var onPlatform, total int
+	for _, other := range m.reservations {
+		if !other.overlaps(r) {
+			continue
+		}
+		total += other.Count
+		if other.Platform == r.Platform {
+			onPlatform += other.Count
+		}
+	}
+	if onPlatform+r.Count > limit || total+r.Count > m.maxClusters {
+		return "", fmt.Errorf("there is not enough `%s` capacity left to reserve %d clusters at that time, see `reservations` for existing bookings", r.Platform, r.Count)
+	}
+
+	m.reservationCount++
+	r.ID = fmt.Sprintf("r%d", m.reservationCount)
+	m.reservations = append(m.reservations, r)
+	klog.Infof("user %q reserved %d %s clusters from %s for %s as %s", r.User, r.Count, r.Platform, r.Start.Format(time.RFC3339), r.Duration, r.ID)
+	return fmt.Sprintf("reserved %d `%s` clusters from %s UTC for %s as `%s`. I'll launch them for you when the reservation starts, cancel it with `unreserve %s`", r.Count, r.Platform, r.Start.UTC().Format("2006-01-02 15:04"), r.Duration, r.ID, r.ID), nil
+}
+
+func (m *jobManager) CancelReservationForUser(user, id string) (string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for i, r := range m.reservations {
+		if r.ID != id {
+			continue
+		}
+		if r.User != user {
+			return "", fmt.Errorf("reservation `%s` belongs to someone else", id)
+		}
+		m.reservations = append(m.reservations[:i], m.reservations[i+1:]...)
+		klog.Infof("user %q cancelled reservation %s", user, id)
+		m.startWaitlistedJobs()
+		if r.Launched {
+			return fmt.Sprintf("reservation `%s` was cancelled, the clusters that were already launched keep running until you shut them down with `done %s`", id, r.clusterName(1)), nil
+		}
+		return fmt.Sprintf("reservation `%s` was cancelled", id), nil
+	}
+	return "", fmt.Errorf("there is no reservation `%s`, see `reservations`", id)
+}
+
+func (m *jobManager) ListReservations() string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if len(m.reservations) == 0 {
+		return "There are no reservations"
+	}
+	reservations := make([]*Reservation, len(m.reservations))
+	copy(reservations, m.reservations)
+	sort.Slice(reservations, func(i, j int) bool { return reservations[i].Start.Before(reservations[j].Start) })
+
+	now := time.Now()
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%d reservations:\n\n", len(reservations))
+	for _, r := range reservations {
+		state := "scheduled"
+		if r.Active(now) {
+			state = fmt.Sprintf("active, ends in %d minutes", int(r.End().Sub(now)/time.Minute))
+		}
+		fmt.Fprintf(buf, "• `%s` <@%s> - %d `%s` clusters from %s UTC for %s (%s)\n", r.ID, r.User, r.Count, r.Platform, r.Start.UTC().Format("2006-01-02 15:04"), r.Duration, state)
+	}
+	return buf.String()
+}
+
+// heldCapacity returns the slots held back for active reservations from jobs that are not part of
+// them, in total and on the job's platform. Caller must hold the lock.
+func (m *jobManager) heldCapacity(job *Job, now time.Time) (int, int) {
+	var total, onPlatform int
+	for _, r := range m.reservations {
+		if !r.Active(now) || r.ID == job.Reservation {
+			continue
+		}
+		held := r.Count - r.Failed - m.launchedForReservation(r.ID)
+		if held <= 0 {
+			continue
+		}
+		total += held
+		if r.Platform == job.Platform {
+			onPlatform += held
+		}
+	}
+	return total, onPlatform
+}
+
+// launchedForReservation returns the number of running or starting clusters that were launched
+// for the reservation. Caller must hold the lock.
+func (m *jobManager) launchedForReservation(id string) int {
+	var count int
+	for _, job := range m.jobs {
+		if job.Reservation == id && !job.Phase.Stopped() {
+			count++
+		}
+	}
+	return count
+}
+
+// startReservations launches the clusters of reservations whose window has started and forgets
+// reservations that are over.
+func (m *jobManager) startReservations() {
+	now := time.Now()
+	m.lock.Lock()
+	var starting []Reservation
+	var remaining []*Reservation
+	for _, r := range m.reservations {
+		if !now.Before(r.End()) {
+			klog.Infof("reservation %s has ended", r.ID)
+			continue
+		}
+		remaining = append(remaining, r)
+		if r.Active(now) && !r.Launched {
+			r.Launched = true
+			starting = append(starting, *r)
+		}
+	}
+	m.reservations = remaining
+	m.lock.Unlock()
+
+	for _, r := range starting {
+		for i := 1; i <= r.Count; i++ {
+			msg, err := m.launchFn(&JobRequest{
+				OriginalMessage: fmt.Sprintf("reservation %s", r.ID),
+				User:            r.User,
+				Type:            JobTypeInstall,
+				Channel:         r.Channel,
+				Platform:        r.Platform,
+				ClusterName:     r.clusterName(i),
+				Reservation:     r.ID,
+				Lifetime:        r.End().Sub(now),
+				Priority:        PriorityHigh,
+			})
+			// a launched or waitlisted cluster is also described by the error
+			if err != nil {
+				msg = err.Error()
+			}
+			m.lock.Lock()
+			if m.clusterRequested(r.User, r.clusterName(i)) {
+				m.sendMessage(r.Channel, fmt.Sprintf("Reservation `%s` has started, cluster `%s`: %s", r.ID, r.clusterName(i), msg))
+			} else {
+				klog.Errorf("Reservation %s could not launch cluster %s: %s", r.ID, r.clusterName(i), msg)
+				m.releaseReservationSlot(r.ID)
+				m.sendMessage(r.Channel, fmt.Sprintf("Reservation `%s` has started, but cluster `%s` could not be launched: %s. Its slot is no longer held for you, you may `launch` a replacement while capacity is available", r.ID, r.clusterName(i), msg))
+			}
+			m.lock.Unlock()
+		}
+	}
+}
+
+// clusterRequested reports whether the user's cluster is launching, running or waiting for a
+// slot. Caller must hold the lock.
+func (m *jobManager) clusterRequested(user, clusterName string) bool {
+	req, ok := m.requests[requestKey(user, clusterName)]
+	if !ok {
+		return false
+	}
+	if len(req.Name) == 0 {
+		return m.waitlistPosition(req) > 0
+	}
+	job, ok := m.jobs[req.Name]
+	return ok && !job.Phase.Stopped()
+}
+
+// releaseReservationSlot stops holding the slot of a cluster that could not be launched for the
+// reservation, so it is not kept from everyone else for the rest of the window. Caller must hold
+// the lock.
+func (m *jobManager) releaseReservationSlot(id string) {
+	for _, r := range m.reservations {
+		if r.ID == id {
+			r.Failed++
+			m.startWaitlistedJobs()
+			return
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseReservationStart(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected time.Time
+		invalid  bool
+	}{
+		{value: "2026-11-03T14:00", expected: time.Date(2026, 11, 3, 14, 0, 0, 0, time.UTC)},
+		{value: "2026-11-03T14:00:00Z", expected: time.Date(2026, 11, 3, 14, 0, 0, 0, time.UTC)},
+		{value: "2026-11-03T14:00:00+02:00", expected: time.Date(2026, 11, 3, 12, 0, 0, 0, time.UTC)},
+		{value: "2026-11-03 14:00", invalid: true},
+		{value: "14:00", invalid: true},
+		{value: "tomorrow", invalid: true},
+		{value: "", invalid: true},
+	}
+	for _, tc := range testCases {
+		start, err := parseReservationStart(tc.value)
+		if tc.invalid {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %s", tc.value, start)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.value, err)
+			continue
+		}
+		if !start.Equal(tc.expected) {
+			t.Errorf("%q: expected %s, got %s", tc.value, tc.expected, start)
+		}
+	}
+}
+
+func TestReserveForUser(t *testing.T) {
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	existing := func() []*Reservation {
+		return []*Reservation{
+			{ID: "r1", User: "U1", Count: 2, Platform: "aws", Start: start, Duration: 3 * time.Hour},
+			{ID: "r2", User: "U2", Count: 1, Platform: "gcp", Start: start.Add(time.Hour), Duration: 2 * time.Hour},
+		}
+	}
+	testCases := []struct {
+		name        string
+		reservation Reservation
+		capacity    map[string]PlatformCapacity
+		valid       bool
+	}{
+		{
+			name:        "fits next to the existing reservations",
+			reservation: Reservation{Count: 1, Platform: "aws", Start: start, Duration: 2 * time.Hour},
+			valid:       true,
+		},
+		{
+			name:        "overlapping reservations exceed the total",
+			reservation: Reservation{Count: 2, Platform: "azure", Start: start.Add(2 * time.Hour), Duration: time.Hour},
+		},
+		{
+			name:        "a reservation after the others end may use every slot",
+			reservation: Reservation{Count: 4, Platform: "aws", Start: start.Add(3 * time.Hour), Duration: time.Hour},
+			valid:       true,
+		},
+		{
+			name:        "a reservation that ends when the others start may use every slot",
+			reservation: Reservation{Count: 4, Platform: "aws", Start: start.Add(-time.Hour), Duration: time.Hour},
+			valid:       true,
+		},
+		{
+			name:        "overlapping reservations exceed the platform limit",
+			reservation: Reservation{Count: 1, Platform: "aws", Start: start.Add(2 * time.Hour), Duration: time.Hour},
+			capacity:    map[string]PlatformCapacity{"aws": {Limit: 2}},
+		},
+		{
+			name:        "the platform limit does not count other platforms",
+			reservation: Reservation{Count: 1, Platform: "gcp", Start: start.Add(time.Hour), Duration: time.Hour},
+			capacity:    map[string]PlatformCapacity{"gcp": {Limit: 2}},
+			valid:       true,
+		},
+		{
+			name:        "no clusters",
+			reservation: Reservation{Count: 0, Platform: "aws", Start: start.Add(5 * time.Hour), Duration: time.Hour},
+		},
+		{
+			name:        "too short",
+			reservation: Reservation{Count: 1, Platform: "aws", Start: start.Add(5 * time.Hour), Duration: 30 * time.Minute},
+		},
+		{
+			name:        "longer than the maximum lifetime",
+			reservation: Reservation{Count: 1, Platform: "aws", Start: start.Add(5 * time.Hour), Duration: 13 * time.Hour},
+		},
+		{
+			name:        "in the past",
+			reservation: Reservation{Count: 1, Platform: "aws", Start: time.Now().Add(-2 * time.Hour), Duration: 4 * time.Hour},
+		},
+		{
+			name:        "unknown platform",
+			reservation: Reservation{Count: 1, Platform: "mainframe", Start: start.Add(5 * time.Hour), Duration: time.Hour},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &jobManager{
+				maxClusters:      4,
+				maxLifetime:      12 * time.Hour,
+				capacity:         &CapacityConfig{Platforms: tc.capacity},
+				reservations:     existing(),
+				reservationCount: 2,
+			}
+			r := tc.reservation
+			r.User = "U3"
+			_, err := m.ReserveForUser(&r)
+			if tc.valid {
+				if err != nil {
+					t.Fatalf("expected the reservation to be accepted: %v", err)
+				}
+				if r.ID != "r3" || len(m.reservations) != 3 {
+					t.Errorf("expected the reservation to be added as r3, got %q with %d reservations", r.ID, len(m.reservations))
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected the reservation to be rejected")
+			}
+			if len(m.reservations) != 2 {
+				t.Errorf("a rejected reservation was added")
+			}
+		})
+	}
+}
+
+func TestHeldCapacity(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	active := func(id, platform string, count, failed int) *Reservation {
+		return &Reservation{ID: id, Platform: platform, Count: count, Failed: failed, Start: now.Add(-time.Hour), Duration: 3 * time.Hour, Launched: true}
+	}
+	testCases := []struct {
+		name       string
+		reserved   []*Reservation
+		jobs       []*Job
+		job        *Job
+		total      int
+		onPlatform int
+	}{
+		{
+			name:       "active reservations hold their slots",
+			reserved:   []*Reservation{active("r1", "aws", 2, 0), active("r2", "gcp", 1, 0)},
+			job:        &Job{Platform: "aws"},
+			total:      3,
+			onPlatform: 2,
+		},
+		{
+			name:     "reservations that have not started hold nothing",
+			reserved: []*Reservation{{ID: "r1", Platform: "aws", Count: 2, Start: now.Add(time.Hour), Duration: time.Hour}},
+			job:      &Job{Platform: "aws"},
+		},
+		{
+			name:     "the reservation does not hold slots from its own clusters",
+			reserved: []*Reservation{active("r1", "aws", 2, 0)},
+			job:      &Job{Platform: "aws", Reservation: "r1"},
+		},
+		{
+			name:       "launched clusters use up the held slots",
+			reserved:   []*Reservation{active("r1", "aws", 2, 0)},
+			jobs:       []*Job{{Name: "a", Reservation: "r1", Phase: JobPhaseInstalling}, {Name: "b", Reservation: "r1", Phase: JobPhaseSucceeded}},
+			job:        &Job{Platform: "aws"},
+			total:      1,
+			onPlatform: 1,
+		},
+		{
+			name:     "clusters that failed to launch release their slots",
+			reserved: []*Reservation{active("r1", "aws", 2, 1)},
+			jobs:     []*Job{{Name: "a", Reservation: "r1", Phase: JobPhaseReady}},
+			job:      &Job{Platform: "aws"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &jobManager{reservations: tc.reserved, jobs: make(map[string]*Job)}
+			for _, job := range tc.jobs {
+				m.jobs[job.Name] = job
+			}
+			total, onPlatform := m.heldCapacity(tc.job, now)
+			if total != tc.total || onPlatform != tc.onPlatform {
+				t.Errorf("expected %d held slots with %d on the platform, got %d and %d", tc.total, tc.onPlatform, total, onPlatform)
+			}
+		})
+	}
+}
+
+func TestStartReservations(t *testing.T) {
+	// launches mimic the outcomes of LaunchJobForUser, which also describes launched and
+	// waitlisted clusters with an error
+	launches := map[string]func(m *jobManager, req *JobRequest) (string, error){
+		"launched": func(m *jobManager, req *JobRequest) (string, error) {
+			req.Name = "chat-bot-" + req.ClusterName
+			m.requests[requestKey(req.User, req.ClusterName)] = req
+			m.jobs[req.Name] = &Job{Name: req.Name, Mode: JobTypeLaunch, Reservation: req.Reservation, Phase: JobPhaseCreating}
+			return "", errors.New("a cluster is being created - I'll send you the credentials in about 30 minutes")
+		},
+		"waitlisted": func(m *jobManager, req *JobRequest) (string, error) {
+			m.requests[requestKey(req.User, req.ClusterName)] = req
+			m.waitlist = append(m.waitlist, waitlistEntry{request: req, job: &Job{Mode: JobTypeLaunch, Reservation: req.Reservation, Phase: JobPhaseQueued}})
+			return "", errors.New("no clusters are currently available, you are #1 on the waitlist")
+		},
+		"not started": func(m *jobManager, req *JobRequest) (string, error) {
+			req.Name = "chat-bot-" + req.ClusterName
+			m.requests[requestKey(req.User, req.ClusterName)] = req
+			m.jobs[req.Name] = &Job{Name: req.Name, Mode: JobTypeLaunch, Reservation: req.Reservation, Phase: JobPhaseFailed}
+			return "", errors.New("the requested job cannot be started: connection refused")
+		},
+		"rejected": func(m *jobManager, req *JobRequest) (string, error) {
+			return "", errors.New("configuration error, unable to find prow job")
+		},
+	}
+	testCases := []struct {
+		name     string
+		outcomes []string
+		failed   int
+	}{
+		{name: "launched clusters keep their slots", outcomes: []string{"launched", "launched"}},
+		{name: "waitlisted clusters keep their slots", outcomes: []string{"waitlisted"}},
+		{name: "clusters that are not started release their slots", outcomes: []string{"not started", "rejected"}, failed: 2},
+		{name: "only failed clusters release their slots", outcomes: []string{"launched", "waitlisted", "rejected"}, failed: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			messages := make(chan string, 10)
+			r := &Reservation{ID: "r1", User: "U1", Channel: "D1", Count: len(tc.outcomes), Platform: "aws", Start: time.Now().Add(-time.Minute), Duration: 2 * time.Hour}
+			m := &jobManager{
+				requests:     make(map[string]*JobRequest),
+				jobs:         make(map[string]*Job),
+				reservations: []*Reservation{r},
+				messageFn: func(channel, thread, message string, actions ...MessageAction) {
+					messages <- message
+				},
+			}
+			m.launchFn = func(req *JobRequest) (string, error) {
+				m.lock.Lock()
+				defer m.lock.Unlock()
+				var n int
+				fmt.Sscanf(strings.TrimPrefix(req.ClusterName, "r1-"), "%d", &n)
+				return launches[tc.outcomes[n-1]](m, req)
+			}
+			m.startReservations()
+
+			if !r.Launched {
+				t.Errorf("the reservation was not marked as launched")
+			}
+			if r.Failed != tc.failed {
+				t.Errorf("expected %d released slots, got %d", tc.failed, r.Failed)
+			}
+			var released int
+			for range tc.outcomes {
+				select {
+				case message := <-messages:
+					if strings.Contains(message, "could not be launched") {
+						released++
+					}
+				case <-time.After(time.Second):
+					t.Fatal("expected a message for every cluster")
+				}
+			}
+			if released != tc.failed {
+				t.Errorf("expected the owner to be told about %d released slots, got %d", tc.failed, released)
+			}
+		})
+	}
+}
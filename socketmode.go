@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/slack-go/slack"
+	"k8s.io/klog"
+)
+
+// handleEvent handles the event of an event callback. Like over RTM, only direct messages and
+// mentions of the bot are treated as commands.
+func (f *slackFrontend) handleEvent(payload []byte) {
+	var callback struct {
+		Type  string          `json:"type"`
+		Event json.RawMessage `json:"event"`
+	}
+	if err := json.Unmarshal(payload, &callback); err != nil {
+		klog.Infof("unable to parse event callback: %v", err)
+		return
+	}
+	if callback.Type != "event_callback" {
+		return
+	}
+	var event struct {
+		slack.Msg
+		ChannelType string `json:"channel_type"`
+	}
+	if err := json.Unmarshal(callback.Event, &event); err != nil {
+		klog.Infof("unable to parse event: %v", err)
+		return
+	}
+	switch event.Type {
+	case "app_home_opened":
+		f.publishHome(event.User)
+		return
+	case "link_shared":
+		f.unfurlLinks(callback.Event)
+		return
+	}
+	switch {
+	case len(event.SubType) > 0, len(event.BotID) > 0, len(event.User) == 0, event.User == f.botUserID:
+		return
+	case event.Type == "message" && event.ChannelType == "im":
+	case event.Type == "app_mention":
+	default:
+		return
+	}
+	f.handleMessage(&slack.MessageEvent{Msg: event.Msg})
+}
+
+// handleSlashCommand runs the command given as the text of a slash command, e.g.
+// `/cluster-bot launch 4.10 aws`. A launch without arguments opens the launch form. Only the user
+// sees the answer, and later messages about the command are sent to them directly.
+func (f *slackFrontend) handleSlashCommand(command slack.SlashCommand) {
+	if strings.TrimSpace(command.Text) == "launch" && len(command.TriggerID) > 0 {
+		f.openLaunchForm(command.TriggerID)
+		return
+	}
+	request := &ChatRequest{
+		User:    command.UserID,
+		Channel: command.ChannelID,
+		Text:    strings.TrimSpace(command.Text),
+	}
+	response := &slashCommandResponse{channel: command.ChannelID, responseURL: command.ResponseURL}
+	// only the user sees a slash command and its answer, so later messages about it, like the
+	// progress of a launch, are sent to them directly instead of to the channel
+	if !f.IsDirectChannel(command.ChannelID) {
+		channel, err := f.PrivateChannel(command.UserID)
+		if err != nil {
+			klog.Warningf("Failed to open a direct message with %s: %v", command.UserID, err)
+			response.Reply("I was unable to open a direct conversation with you, please send me the command as a direct message")
+			return
+		}
+		request.Channel, request.SentIn = channel, command.ChannelID
+	}
+	f.bot.HandleCommand(request, response)
+}
+
+// socketModeEnvelope is a message received over a socket mode connection.
+type socketModeEnvelope struct {
+	Type       string          `json:"type"`
+	EnvelopeID string          `json:"envelope_id"`
+	Payload    json.RawMessage `json:"payload"`
+	Reason     string          `json:"reason"`
+}
+
+// identify looks up the user of the bot, to ignore the messages the bot sends itself.
+func (f *slackFrontend) identify() error {
+	auth, err := f.client.AuthTest()
+	if err != nil {
+		return fmt.Errorf("unable to identify the bot user: %v", err)
+	}
+	f.botUserID = auth.UserID
+	return nil
+}
+
+// listenSocketMode receives events, slash commands and interactions over a socket mode connection,
+// reconnecting whenever slack closes the connection.
+func (f *slackFrontend) listenSocketMode() error {
+	if err := f.identify(); err != nil {
+		return err
+	}
+	klog.Infof("ci-chat-bot up and listening to slack in socket mode")
+	for {
+		if err := f.runSocketMode(); err != nil {
+			klog.Warningf("socket mode connection lost: %v", err)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func (f *slackFrontend) runSocketMode() error {
+	wsURL, err := openSocketModeConnection(f.appToken)
+	if err != nil {
+		return err
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for {
+		var envelope socketModeEnvelope
+		if err := conn.ReadJSON(&envelope); err != nil {
+			return err
+		}
+		// every envelope must be acknowledged within a few seconds, so they are handled asynchronously
+		if len(envelope.EnvelopeID) > 0 {
+			if err := conn.WriteJSON(map[string]string{"envelope_id": envelope.EnvelopeID}); err != nil {
+				return err
+			}
+		}
+		switch envelope.Type {
+		case "hello":
+			klog.Infof("connected to slack in socket mode")
+		case "disconnect":
+			klog.Infof("slack requested a reconnect: %s", envelope.Reason)
+			return nil
+		case "events_api":
+			go f.handleEvent(envelope.Payload)
+		case "slash_commands":
+			var command slack.SlashCommand
+			if err := json.Unmarshal(envelope.Payload, &command); err != nil {
+				klog.Infof("unable to parse slash command: %v", err)
+				continue
+			}
+			go f.handleSlashCommand(command)
+		case "interactive":
+			var callback slack.InteractionCallback
+			if err := json.Unmarshal(envelope.Payload, &callback); err != nil {
+				klog.Infof("unable to parse interaction payload: %v", err)
+				continue
+			}
+			go f.handleInteraction(callback)
+		}
+	}
+}
+
+// openSocketModeConnection requests the URL of a new socket mode connection with the app level token.
+func openSocketModeConnection(appToken string) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, "https://slack.com/api/apps.connections.open", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+appToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		slack.SlackResponse
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("unable to parse apps.connections.open response: %v", err)
+	}
+	if !result.Ok {
+		return "", fmt.Errorf("unable to open a socket mode connection: %s", result.Error)
+	}
+	return result.URL, nil
+}
+
+// serveEvents receives events, slash commands and interactions over HTTP. Every request must be
+// signed with the signing secret of the app.
+func (f *slackFrontend) serveEvents() error {
+	if err := f.identify(); err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/slack/interactive", f.interactionHandler())
+	mux.HandleFunc("/slack/events", func(w http.ResponseWriter, r *http.Request) {
+		body, err := verifiedBody(r, f.signingSecret)
+		if err != nil {
+			klog.Infof("rejected event: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var challenge struct {
+			Type      string `json:"type"`
+			Challenge string `json:"challenge"`
+		}
+		if err := json.Unmarshal(body, &challenge); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if challenge.Type == "url_verification" {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(challenge.Challenge))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		// the event was already delivered, slack only retries if it did not get an answer in time
+		if len(r.Header.Get("X-Slack-Retry-Num")) > 0 {
+			return
+		}
+		go f.handleEvent(body)
+	})
+	mux.HandleFunc("/slack/commands", func(w http.ResponseWriter, r *http.Request) {
+		body, err := verifiedBody(r, f.signingSecret)
+		if err != nil {
+			klog.Infof("rejected slash command: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		command, err := slack.SlashCommandParse(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		go f.handleSlashCommand(command)
+	})
+	klog.Infof("ci-chat-bot up and listening to slack events on %s", f.address)
+	return http.ListenAndServe(f.address, mux)
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+// defaultHistoryRetention is how long completed jobs are remembered if the quota window is shorter.
+const defaultHistoryRetention = 30 * 24 * time.Hour
+
+// StateStore persists the state of the job manager that cannot be recovered from prow jobs, so a
+// restart of the bot loses no requests and history outlives the garbage collection of prow jobs.
+type StateStore interface {
+	// Load returns the last saved state, or an empty state if none was saved yet.
+	Load() (*StoredState, error)
+	Save(state *StoredState) error
+}
+
+// StoredState is everything the job manager saves. Jobs that are running are not included, they are
+// rebuilt from their prow jobs.
+type StoredState struct {
+	Requests         []*JobRequest           `json:"requests,omitempty"`
+	Waitlist         []StoredWaitlistEntry   `json:"waitlist,omitempty"`
+	Approvals        map[string]*JobRequest  `json:"approvals,omitempty"`
+	ApprovalCount    int                     `json:"approvalCount,omitempty"`
+	Reservations     []*Reservation          `json:"reservations,omitempty"`
+	ReservationCount int                     `json:"reservationCount,omitempty"`
+	StartEstimates   []time.Duration         `json:"startEstimates,omitempty"`
+	History          []JobRecord             `json:"history,omitempty"`
+	Settings         map[string]UserSettings `json:"settings,omitempty"`
+}
+
+// StoredWaitlistEntry is a request on the waitlist, identified by its key in the requests.
+type StoredWaitlistEntry struct {
+	Request string `json:"request"`
+	Job     *Job   `json:"job"`
+}
+
+// JobRecord remembers a job after it completed.
+type JobRecord struct {
+	Name        string    `json:"name"`
+	User        string    `json:"user"`
+	ClusterName string    `json:"clusterName,omitempty"`
+	Mode        string    `json:"mode"`
+	Platform    string    `json:"platform,omitempty"`
+	Inputs      string    `json:"inputs,omitempty"`
+	URL         string    `json:"url,omitempty"`
+	Failure     string    `json:"failure,omitempty"`
+	StartedAt   time.Time `json:"startedAt"`
+	CompletedAt time.Time `json:"completedAt"`
+}
+
+// UserSettings are the defaults a user has chosen for their requests.
+type UserSettings struct {
+	// Platform is used when a launch does not name a platform
+	Platform string `json:"platform,omitempty"`
+}
+
+// fileStore keeps the state in a JSON file on local or mounted storage.
+type fileStore struct {
+	path string
+}
+
+func NewFileStore(path string) StateStore {
+	return &fileStore{path: path}
+}
+
+func (s *fileStore) Load() (*StoredState, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return &StoredState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &StoredState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", s.path, err)
+	}
+	return state, nil
+}
+
+func (s *fileStore) Save(state *StoredState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	// write a temporary file and rename it so a crash never leaves a partial state behind
+	f, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
+
+// configMapStateKey is the key of the state in the config map.
+const configMapStateKey = "state.json"
+
+// configMapStore keeps the state in a config map, so it survives the bot being rescheduled without
+// a volume. Config maps are limited to 1MiB, which holds several thousand history records.
+type configMapStore struct {
+	client    clientset.Interface
+	namespace string
+	name      string
+}
+
+func NewConfigMapStore(client clientset.Interface, namespace, name string) StateStore {
+	return &configMapStore{client: client, namespace: namespace, name: name}
+}
+
+func (s *configMapStore) Load() (*StoredState, error) {
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(context.TODO(), s.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return &StoredState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &StoredState{}
+	if data := cm.Data[configMapStateKey]; len(data) > 0 {
+		if err := json.Unmarshal([]byte(data), state); err != nil {
+			return nil, fmt.Errorf("unable to parse config map %s/%s: %v", s.namespace, s.name, err)
+		}
+	}
+	return state, nil
+}
+
+func (s *configMapStore) Save(state *StoredState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+	cm, err := configMaps.Get(context.TODO(), s.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = configMaps.Create(context.TODO(), &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: s.namespace, Name: s.name},
+			Data:       map[string]string{configMapStateKey: string(data)},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[configMapStateKey] = string(data)
+	_, err = configMaps.Update(context.TODO(), cm, metav1.UpdateOptions{})
+	return err
+}
+
+// restoreState loads the saved state into the manager before the first sync.
+func (m *jobManager) restoreState() error {
+	if m.store == nil {
+		return nil
+	}
+	state, err := m.store.Load()
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, req := range state.Requests {
+		m.requests[requestKey(req.User, req.ClusterName)] = req
+	}
+	for _, entry := range state.Waitlist {
+		// entries refer to the request in the requests so cancelling either cancels both
+		if req, ok := m.requests[entry.Request]; ok && entry.Job != nil {
+			m.waitlist = append(m.waitlist, waitlistEntry{request: req, job: entry.Job})
+		}
+	}
+	for id, req := range state.Approvals {
+		m.approvals[id] = req
+	}
+	m.approvalCount = state.ApprovalCount
+	m.reservations = state.Reservations
+	m.reservationCount = state.ReservationCount
+	m.recentStartEstimates = state.StartEstimates
+	m.history = state.History
+	for user, settings := range state.Settings {
+		m.settings[user] = settings
+	}
+	m.savedState, _ = json.Marshal(state)
+	klog.Infof("Restored %d requests, %d waiting, %d reservations and %d completed jobs", len(m.requests), len(m.waitlist), len(m.reservations), len(m.history))
+	return nil
+}
+
+// saveState writes the state to the store if it changed since it was last saved.
+func (m *jobManager) saveState() {
+	m.lock.Lock()
+	state := &StoredState{
+		Approvals:        m.approvals,
+		ApprovalCount:    m.approvalCount,
+		Reservations:     m.reservations,
+		ReservationCount: m.reservationCount,
+		StartEstimates:   m.recentStartEstimates,
+		History:          m.history,
+		Settings:         m.settings,
+	}
+	for _, req := range m.requests {
+		state.Requests = append(state.Requests, req)
+	}
+	sort.Slice(state.Requests, func(i, j int) bool {
+		return requestKey(state.Requests[i].User, state.Requests[i].ClusterName) < requestKey(state.Requests[j].User, state.Requests[j].ClusterName)
+	})
+	for _, entry := range m.waitlist {
+		state.Waitlist = append(state.Waitlist, StoredWaitlistEntry{Request: requestKey(entry.request.User, entry.request.ClusterName), Job: entry.job})
+	}
+	// encode while holding the lock, the state shares the maps and requests of the manager
+	data, err := json.Marshal(state)
+	changed := !bytes.Equal(data, m.savedState)
+	m.lock.Unlock()
+
+	if err != nil {
+		klog.Errorf("Unable to encode state: %v", err)
+		return
+	}
+	if !changed {
+		return
+	}
+	// save a copy, the requests and reservations keep changing once the lock is released
+	saved := &StoredState{}
+	if err := json.Unmarshal(data, saved); err != nil {
+		klog.Errorf("Unable to copy state: %v", err)
+		return
+	}
+	if err := m.store.Save(saved); err != nil {
+		klog.Errorf("Unable to save state: %v", err)
+		return
+	}
+	m.lock.Lock()
+	m.savedState = data
+	m.lock.Unlock()
+}
+
+// recordHistory remembers a completed job. Caller must hold the lock.
+func (m *jobManager) recordHistory(job *Job, startedAt, completedAt time.Time) {
+	for _, record := range m.history {
+		if record.Name == job.Name {
+			return
+		}
+	}
+	m.history = append(m.history, JobRecord{
+		Name:        job.Name,
+		User:        job.RequestedBy,
+		ClusterName: job.ClusterName,
+		Mode:        job.Mode,
+		Platform:    job.Platform,
+		Inputs:      describeInputs(job),
+		URL:         job.URL,
+		Failure:     job.Failure,
+		StartedAt:   startedAt,
+		CompletedAt: completedAt,
+	})
+
+	retention := m.quotaWindow
+	if retention < defaultHistoryRetention {
+		retention = defaultHistoryRetention
+	}
+	cutoff := completedAt.Add(-retention)
+	history := m.history[:0]
+	for _, record := range m.history {
+		if !record.CompletedAt.Before(cutoff) {
+			history = append(history, record)
+		}
+	}
+	m.history = history
+}
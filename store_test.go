@@ -0,0 +1,148 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// countingStore counts how often the state is saved.
+type countingStore struct {
+	StateStore
+	saves int
+}
+
+func (s *countingStore) Save(state *StoredState) error {
+	s.saves++
+	return s.StateStore.Save(state)
+}
+
+func newStoreTestManager(store StateStore) *jobManager {
+	return &jobManager{
+		requests:  make(map[string]*JobRequest),
+		jobs:      make(map[string]*Job),
+		approvals: make(map[string]*JobRequest),
+		settings:  make(map[string]UserSettings),
+		store:     store,
+	}
+}
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := &countingStore{StateStore: NewFileStore(path)}
+	now := time.Unix(1700000000, 0).UTC()
+
+	m := newStoreTestManager(store)
+	running := &JobRequest{User: "U1", Type: JobTypeInstall, Platform: "aws", Name: "chat-bot-2023-11-14-221320.0000", RequestedAt: now}
+	waiting := &JobRequest{User: "U2", ClusterName: "demo", Type: JobTypeInstall, Platform: "gcp", Channel: "D2", RequestedAt: now, Priority: PriorityHigh}
+	m.requests[requestKey(running.User, running.ClusterName)] = running
+	m.requests[requestKey(waiting.User, waiting.ClusterName)] = waiting
+	m.waitlist = []waitlistEntry{{request: waiting, job: &Job{Name: "chat-bot-2023-11-14-221400.0000", Mode: JobTypeLaunch, Platform: "gcp", Phase: JobPhaseQueued, ClusterName: "demo", RequestedAt: now}}}
+	m.approvals["a1"] = &JobRequest{User: "U3", Type: JobTypeInstall, Lifetime: 24 * time.Hour, RequestedAt: now}
+	m.approvalCount = 1
+	m.reservations = []*Reservation{{ID: "r1", User: "U4", Count: 2, Platform: "aws", Start: now.Add(time.Hour), Duration: 3 * time.Hour}}
+	m.reservationCount = 1
+	m.recentStartEstimates = []time.Duration{25 * time.Minute, 31 * time.Minute}
+	m.settings["U1"] = UserSettings{Platform: "aws"}
+	m.recordHistory(&Job{Name: "chat-bot-old", RequestedBy: "U1", Mode: JobTypeLaunch, Platform: "aws"}, now.Add(-2*time.Hour), now.Add(-time.Hour))
+
+	m.saveState()
+	if store.saves != 1 {
+		t.Fatalf("expected the state to be saved once, got %d", store.saves)
+	}
+	m.saveState()
+	if store.saves != 1 {
+		t.Errorf("unchanged state was saved again")
+	}
+
+	restored := newStoreTestManager(store)
+	if err := restored.restoreState(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m.requests, restored.requests) {
+		t.Errorf("requests changed in the round trip:\nexpected %#v\ngot      %#v", m.requests, restored.requests)
+	}
+	if len(restored.waitlist) != 1 {
+		t.Fatalf("expected one waitlist entry, got %d", len(restored.waitlist))
+	}
+	// cancelling the request must also take it off the waitlist
+	if entry := restored.waitlist[0]; entry.request != restored.requests[requestKey("U2", "demo")] {
+		t.Errorf("the waitlist entry does not refer to the restored request")
+	}
+	if !reflect.DeepEqual(m.waitlist[0].job, restored.waitlist[0].job) {
+		t.Errorf("waitlisted job changed in the round trip:\nexpected %#v\ngot      %#v", m.waitlist[0].job, restored.waitlist[0].job)
+	}
+	if !reflect.DeepEqual(m.approvals, restored.approvals) || restored.approvalCount != 1 {
+		t.Errorf("approvals changed in the round trip: %#v", restored.approvals)
+	}
+	if !reflect.DeepEqual(m.reservations, restored.reservations) || restored.reservationCount != 1 {
+		t.Errorf("reservations changed in the round trip: %#v", restored.reservations)
+	}
+	if !reflect.DeepEqual(m.recentStartEstimates, restored.recentStartEstimates) {
+		t.Errorf("expected start estimates %v, got %v", m.recentStartEstimates, restored.recentStartEstimates)
+	}
+	if !reflect.DeepEqual(m.history, restored.history) {
+		t.Errorf("history changed in the round trip:\nexpected %#v\ngot      %#v", m.history, restored.history)
+	}
+	if !reflect.DeepEqual(m.settings, restored.settings) {
+		t.Errorf("expected settings %v, got %v", m.settings, restored.settings)
+	}
+
+	restored.saveState()
+	if store.saves != 1 {
+		t.Errorf("the restored state was saved again without changes")
+	}
+	restored.settings["U2"] = UserSettings{Platform: "gcp"}
+	restored.saveState()
+	if store.saves != 2 {
+		t.Errorf("changed state was not saved")
+	}
+}
+
+func TestFileStoreLoadMissingFile(t *testing.T) {
+	state, err := NewFileStore(filepath.Join(t.TempDir(), "state.json")).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(state, &StoredState{}) {
+		t.Errorf("expected an empty state, got %#v", state)
+	}
+}
+
+func TestRecordHistory(t *testing.T) {
+	now := time.Unix(1700000000, 0).UTC()
+	testCases := []struct {
+		name        string
+		quotaWindow time.Duration
+		expected    []string
+	}{
+		{
+			name:     "records older than a month are pruned",
+			expected: []string{"recent", "new"},
+		},
+		{
+			name:        "a longer quota window keeps records for longer",
+			quotaWindow: 60 * 24 * time.Hour,
+			expected:    []string{"old", "recent", "new"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &jobManager{quotaWindow: tc.quotaWindow}
+			m.recordHistory(&Job{Name: "old"}, now.Add(-41*24*time.Hour), now.Add(-40*24*time.Hour))
+			m.recordHistory(&Job{Name: "recent"}, now.Add(-25*time.Hour), now.Add(-24*time.Hour))
+			m.recordHistory(&Job{Name: "new"}, now.Add(-time.Hour), now)
+			// a job that is seen again by a later sync is only recorded once
+			m.recordHistory(&Job{Name: "new"}, now.Add(-time.Hour), now)
+
+			var names []string
+			for _, record := range m.history {
+				names = append(names, record.Name)
+			}
+			if !reflect.DeepEqual(names, tc.expected) {
+				t.Errorf("expected history %v, got %v", tc.expected, names)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+	"k8s.io/klog"
+)
+
+// prowDomain is the domain of the prow links the bot unfurls.
+const prowDomain = "prow.ci.openshift.org"
+
+// linkSharedEvent is sent when a message contains links to a domain the app is registered for.
+type linkSharedEvent struct {
+	Channel   string `json:"channel"`
+	MessageTS string `json:"message_ts"`
+	Links     []struct {
+		Domain string `json:"domain"`
+		URL    string `json:"url"`
+	} `json:"links"`
+}
+
+// unfurlLinks shows the details of the bot's jobs under the prow links in a message, so people
+// can tell what a shared link is about without opening it.
+func (f *slackFrontend) unfurlLinks(payload []byte) {
+	var event linkSharedEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		klog.Infof("unable to parse link_shared event: %v", err)
+		return
+	}
+	unfurls := make(map[string]slack.Attachment)
+	for _, link := range event.Links {
+		if link.Domain != prowDomain {
+			continue
+		}
+		job, err := f.manager.JobForLink(link.URL)
+		if err != nil {
+			klog.V(2).Infof("not unfurling %s: %v", link.URL, err)
+			continue
+		}
+		unfurls[link.URL] = jobUnfurl(job, time.Now())
+	}
+	if len(unfurls) == 0 {
+		return
+	}
+	if _, _, _, err := f.client.UnfurlMessage(event.Channel, event.MessageTS, unfurls); err != nil {
+		klog.Infof("error: unable to unfurl links in %s: %v", event.Channel, err)
+	}
+}
+
+// jobUnfurl summarizes who requested a job, what it runs and where it stands.
+func jobUnfurl(job *Job, now time.Time) slack.Attachment {
+	title := job.OriginalMessage
+	if len(title) == 0 {
+		title = job.Name
+	}
+
+	var inputs []string
+	for i := range job.Inputs {
+		input := &Job{Inputs: job.Inputs[i:]}
+		if description := strings.TrimSpace(describeInputs(input)); len(description) > 0 {
+			inputs = append(inputs, description)
+		}
+	}
+
+	state := phaseDescription(job)
+	if job.Phase == JobPhaseReady {
+		state = "cluster available"
+	}
+	if len(job.StopReason) > 0 {
+		state = fmt.Sprintf("%s (%s)", state, job.StopReason)
+	}
+
+	fields := []slack.AttachmentField{
+		{Title: "Requested by", Value: fmt.Sprintf("<@%s>", job.RequestedBy), Short: true},
+		{Title: "Mode", Value: job.Mode, Short: true},
+		{Title: "Platform", Value: describeParams(job), Short: true},
+		{Title: "State", Value: state, Short: true},
+	}
+	if len(inputs) > 0 {
+		fields = append(fields, slack.AttachmentField{Title: "Inputs", Value: strings.Join(inputs, "\n")})
+	}
+	if !job.Phase.Stopped() && !job.ExpiresAt.IsZero() && job.ExpiresAt.After(now) {
+		fields = append(fields, slack.AttachmentField{Title: "Expires", Value: fmt.Sprintf("in %d minutes", int(job.ExpiresAt.Sub(now)/time.Minute)), Short: true})
+	}
+	if len(job.ClusterName) > 0 {
+		fields = append(fields, slack.AttachmentField{Title: "Cluster", Value: job.ClusterName, Short: true})
+	}
+
+	return slack.Attachment{
+		Title:     title,
+		TitleLink: job.URL,
+		Fields:    fields,
+		Footer:    fmt.Sprintf("cluster-bot job %s", job.Name),
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+	prowapiv1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
+
+	"github.com/openshift/ci-chat-bot/pkg/prow"
+)
+
+const (
+	// prowJobResyncPeriod is how often every prow job is delivered again, so the manager syncs even
+	// if no job changed
+	prowJobResyncPeriod = 5 * time.Minute
+	// jobRecheckInterval is how often a worker checks on its job without being woken by a change, in
+	// case a change was missed while a watch was being reestablished
+	jobRecheckInterval = time.Minute
+)
+
+// newProwJobInformer watches the prow jobs launched by the bot.
+func newProwJobInformer(client dynamic.NamespaceableResourceInterface, namespace string) cache.SharedIndexInformer {
+	selector := labels.SelectorFromSet(labels.Set{labelLaunch: "true"}).String()
+	return cache.NewSharedIndexInformer(&cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = selector
+			return client.Namespace(namespace).List(context.TODO(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = selector
+			return client.Namespace(namespace).Watch(context.TODO(), options)
+		},
+	}, &unstructured.Unstructured{}, prowJobResyncPeriod, cache.Indexers{})
+}
+
+// startWatching starts the prow job informer and syncs whenever a prow job changes, or at least
+// every resync period.
+func (m *jobManager) startWatching() {
+	m.prowJobs.AddEventHandler(m.jobEventHandler(func(name string) {
+		m.requestSync()
+	}))
+	go m.prowJobs.Run(wait.NeverStop)
+	go func() {
+		cache.WaitForCacheSync(wait.NeverStop, m.prowJobs.HasSynced)
+		m.requestSync()
+		wait.Forever(func() {
+			select {
+			case <-m.syncRequested:
+			case <-time.After(prowJobResyncPeriod):
+			}
+			if err := m.sync(); err != nil {
+				klog.Infof("error during sync: %v", err)
+			}
+		}, time.Second)
+	}()
+}
+
+// requestSync asks for a sync, requests made while one is pending are merged into it.
+func (m *jobManager) requestSync() {
+	select {
+	case m.syncRequested <- struct{}{}:
+	default:
+	}
+}
+
+// jobEventHandler wakes up the worker of the job with the same name as an object whenever the object
+// changes, and passes the name to changed if it is set.
+func (m *jobManager) jobEventHandler(changed func(name string)) cache.ResourceEventHandler {
+	handle := func(obj interface{}) {
+		key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+		if err != nil {
+			return
+		}
+		_, name, err := cache.SplitMetaNamespaceKey(key)
+		if err != nil {
+			return
+		}
+		if changed != nil {
+			changed(name)
+		}
+		m.notifyJobChanged(name)
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    handle,
+		UpdateFunc: func(_, obj interface{}) { handle(obj) },
+		DeleteFunc: handle,
+	}
+}
+
+// jobChanged returns a channel that is closed the next time the prow job or pods of a job change.
+func (m *jobManager) jobChanged(name string) <-chan struct{} {
+	m.changes.lock.Lock()
+	defer m.changes.lock.Unlock()
+	ch, ok := m.changes.waiting[name]
+	if !ok {
+		ch = make(chan struct{})
+		m.changes.waiting[name] = ch
+	}
+	return ch
+}
+
+func (m *jobManager) notifyJobChanged(name string) {
+	m.changes.lock.Lock()
+	defer m.changes.lock.Unlock()
+	if ch, ok := m.changes.waiting[name]; ok {
+		close(ch)
+		delete(m.changes.waiting, name)
+	}
+}
+
+// waitForJobChange checks the condition whenever the job changes until it is done, fails or the
+// timeout passes.
+func (m *jobManager) waitForJobChange(name string, timeout time.Duration, condition wait.ConditionFunc) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	recheck := time.NewTicker(jobRecheckInterval)
+	defer recheck.Stop()
+	for {
+		// wait on the channel from before the check, so a change during the check is not missed
+		changed := m.jobChanged(name)
+		if done, err := condition(); err != nil || done {
+			return err
+		}
+		select {
+		case <-changed:
+		case <-recheck.C:
+		case <-deadline.C:
+			return wait.ErrWaitTimeout
+		}
+	}
+}
+
+// listProwJobs returns the prow jobs launched by the bot.
+func (m *jobManager) listProwJobs() ([]prowapiv1.ProwJob, error) {
+	var jobs []prowapiv1.ProwJob
+	for _, obj := range m.prowJobs.GetStore().List() {
+		var pj prowapiv1.ProwJob
+		if err := prow.UnstructuredToObject(obj.(*unstructured.Unstructured), &pj); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, pj)
+	}
+	return jobs, nil
+}
+
+// getProwJob returns a prow job launched by the bot. Jobs that were created too recently to have
+// been seen by the informer are read from the API.
+func (m *jobManager) getProwJob(name string) (*prowapiv1.ProwJob, error) {
+	obj, ok, err := m.prowJobs.GetStore().GetByKey(m.prowNamespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	var u *unstructured.Unstructured
+	if ok {
+		u = obj.(*unstructured.Unstructured)
+	} else if u, err = m.prowClient.Namespace(m.prowNamespace).Get(context.TODO(), name, metav1.GetOptions{}); err != nil {
+		return nil, err
+	}
+	pj := &prowapiv1.ProwJob{}
+	if err := prow.UnstructuredToObject(u, pj); err != nil {
+		return nil, err
+	}
+	return pj, nil
+}
+
+// buildClusterPods returns the pods of the prow jobs launched by the bot on a build cluster. The pods
+// of a build cluster are watched from the first time a job runs on it.
+func (m *jobManager) buildClusterPods(cluster string) (corelisters.PodNamespaceLister, error) {
+	m.podInformers.lock.Lock()
+	defer m.podInformers.lock.Unlock()
+	informer, ok := m.podInformers.informers[cluster]
+	if !ok {
+		clusterClient, ok := m.clusterClients[cluster]
+		if !ok {
+			return nil, fmt.Errorf("Cluster %s not found in %v", cluster, m.clusterClients)
+		}
+		// prow copies the labels of a prow job to its pod
+		informer = coreinformers.NewFilteredPodInformer(clusterClient.CoreClient, m.prowNamespace, 0, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, func(options *metav1.ListOptions) {
+			options.LabelSelector = labels.SelectorFromSet(labels.Set{labelLaunch: "true"}).String()
+		})
+		informer.AddEventHandler(m.jobEventHandler(nil))
+		go informer.Run(wait.NeverStop)
+		m.podInformers.informers[cluster] = informer
+	}
+	return corelisters.NewPodLister(informer.GetIndexer()).Pods(m.prowNamespace), nil
+}
+
+// namespaceWatch watches the namespace a job launches its cluster from: the step secret of step based
+// jobs, or the pods of template based jobs.
+type namespaceWatch struct {
+	pods    corelisters.PodNamespaceLister
+	secrets corelisters.SecretNamespaceLister
+	stop    chan struct{}
+}
+
+// watchNamespace starts watching the namespace of a job until the watch is stopped. Until the
+// namespace and the permission to read it exist the listers find nothing.
+func (m *jobManager) watchNamespace(job *Job, client clientset.Interface, namespace string, stepBased bool) *namespaceWatch {
+	w := &namespaceWatch{stop: make(chan struct{})}
+	// every object in the namespace belongs to the job
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { m.notifyJobChanged(job.Name) },
+		UpdateFunc: func(interface{}, interface{}) { m.notifyJobChanged(job.Name) },
+		DeleteFunc: func(interface{}) { m.notifyJobChanged(job.Name) },
+	}
+	indexers := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+	if stepBased {
+		informer := coreinformers.NewSecretInformer(client, namespace, 0, indexers)
+		informer.AddEventHandler(handler)
+		go informer.Run(w.stop)
+		w.secrets = corelisters.NewSecretLister(informer.GetIndexer()).Secrets(namespace)
+	} else {
+		informer := coreinformers.NewPodInformer(client, namespace, 0, indexers)
+		informer.AddEventHandler(handler)
+		go informer.Run(w.stop)
+		w.pods = corelisters.NewPodLister(informer.GetIndexer()).Pods(namespace)
+	}
+	return w
+}
+
+func (w *namespaceWatch) Stop() {
+	close(w.stop)
+}